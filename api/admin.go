@@ -0,0 +1,278 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// ImpersonationExpiration is how long support can act as another user
+	ImpersonationExpiration = 15 * time.Minute
+	DefaultPageSize         = 20
+	MaxPageSize             = 100
+)
+
+// AdminUser is the view of a user for administrators.
+type AdminUser struct {
+	ID                uint   `json:"id"`
+	Username          string `json:"username"`
+	Role              string `json:"role"`
+	Disabled          bool   `json:"disabled"`
+	MustResetPassword bool   `json:"must_reset_password"`
+	TOTPEnabled       bool   `json:"totp_enabled"`
+	HasPassword       bool   `json:"has_password"`
+}
+
+func newAdminUser(dbUser db.User) AdminUser {
+	role := dbUser.Role
+	if role == "" {
+		role = db.RoleUser
+	}
+	return AdminUser{
+		ID:                dbUser.ID,
+		Username:          dbUser.Username,
+		Role:              role,
+		Disabled:          dbUser.Disabled,
+		MustResetPassword: dbUser.MustResetPassword,
+		TOTPEnabled:       dbUser.TOTPEnabled,
+		HasPassword:       dbUser.PasswordHash != "",
+	}
+}
+
+// RequireAdmin aborts with 403 status, unless the user of the request has
+// the admin role. The role is loaded on every request, so that demotion
+// takes effect immediately. Impersonation tokens never pass.
+func (uc *UserController) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get("jwt_claims"); ok {
+			if claims, _ := value.(*Claims); claims != nil && claims.Actor != nil {
+				abortWithProblem(c, Forbidden())
+				return
+			}
+		}
+		userId, _ := strconv.Atoi(c.GetString("jwt_sub"))
+		var dbUser db.User
+		session := uc.GetSession(c)
+		result := session.Limit(1).Find(&dbUser, userId)
+		if result.Error != nil {
+			abortWithProblem(c, DBProblem(result.Error))
+			return
+		}
+		if result.RowsAffected == 0 || dbUser.Role != db.RoleAdmin || dbUser.Disabled {
+			abortWithProblem(c, Forbidden())
+			return
+		}
+		c.Next()
+	}
+}
+
+// GET /admin/users
+// AdminGetUsers lists users page by page, optionally filtered by "q" in the username.
+func (uc *UserController) AdminGetUsers(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		abortWithProblem(c, NewProblem(http.StatusBadRequest, "Invalid page."))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(DefaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > MaxPageSize {
+		abortWithProblem(c, NewProblem(http.StatusBadRequest, "Page size must be between 1 and "+strconv.Itoa(MaxPageSize)+"."))
+		return
+	}
+
+	session := uc.GetSession(c)
+	query := session.Model(&db.User{})
+	if search := c.Query("q"); search != "" {
+		// Wildcards in the search are matched literally
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search)
+		query = query.Where(`username LIKE ? ESCAPE '\'`, "%"+escaped+"%")
+	}
+	var total int64
+	if result := query.Count(&total); result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	var dbUsers []db.User
+	result := query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&dbUsers)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	users := make([]AdminUser, len(dbUsers))
+	for i, dbUser := range dbUsers {
+		users[i] = newAdminUser(dbUser)
+	}
+	c.PureJSON(http.StatusOK, gin.H{
+		"users":     users,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// GET /admin/users/:id
+func (uc *UserController) AdminGetUserByID(c *gin.Context) {
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	c.PureJSON(http.StatusOK, newAdminUser(dbUser))
+}
+
+// POST /admin/users/:id/disable
+// AdminDisableUser prevents the user from logging in and revokes its tokens.
+func (uc *UserController) AdminDisableUser(c *gin.Context) {
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	if c.GetString("jwt_sub") == strconv.FormatUint(uint64(dbUser.ID), 10) {
+		abortWithProblem(c, Conflict("Administrators cannot disable themselves."))
+		return
+	}
+	session := uc.GetSession(c)
+	if result := session.Model(&dbUser).Update("disabled", true); result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if err := uc.revocations.RevokeUser(dbUser.ID); err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	c.PureJSON(http.StatusOK, newAdminUser(dbUser))
+}
+
+// POST /admin/users/:id/enable
+func (uc *UserController) AdminEnableUser(c *gin.Context) {
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	session := uc.GetSession(c)
+	if result := session.Model(&dbUser).Update("disabled", false); result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusOK, newAdminUser(dbUser))
+}
+
+// POST /admin/users/:id/password-reset
+// AdminForcePasswordReset refuses login with the current password, revokes all
+// tokens of the user and sends a reset token through the notifier.
+func (uc *UserController) AdminForcePasswordReset(c *gin.Context) {
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	session := uc.GetSession(c)
+	if result := session.Model(&dbUser).Update("must_reset_password", true); result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if err := uc.revocations.RevokeUser(dbUser.ID); err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	if err := uc.sendPasswordReset(session, dbUser); err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// PUT /admin/users/:id/role
+func (uc *UserController) AdminPutRole(c *gin.Context) {
+	var apiRole RoleChange
+	if err := c.ShouldBindJSON(&apiRole); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	// Prevents locking out the last administrator by accident
+	if c.GetString("jwt_sub") == strconv.FormatUint(uint64(dbUser.ID), 10) {
+		abortWithProblem(c, Conflict("Administrators cannot change their own role."))
+		return
+	}
+	session := uc.GetSession(c)
+	if result := session.Model(&dbUser).Update("role", apiRole.Role); result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusOK, newAdminUser(dbUser))
+}
+
+// POST /admin/users/:id/impersonate
+// AdminImpersonate issues a short-lived token acting as the user for support.
+// The token names the administrator in the "act" claim, cannot manage the
+// account and cannot be used for administration.
+func (uc *UserController) AdminImpersonate(c *gin.Context) {
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	if dbUser.Role == db.RoleAdmin {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	tokenId, err := newTokenID()
+	if err != nil {
+		abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not sign the token."))
+		return
+	}
+	var scopes []string
+	for _, scope := range AllScopes {
+		if scope != ScopeAccount && scope != ScopeAdmin {
+			scopes = append(scopes, scope)
+		}
+	}
+	now := time.Now()
+	tokenString, err := jwtKeys.Sign(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Subject:   strconv.FormatUint(uint64(dbUser.ID), 10),
+			Audience:  jwt.ClaimStrings{AccessAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ImpersonationExpiration)),
+		},
+		Scope: joinScopes(scopes),
+		Actor: &Actor{Subject: c.GetString("jwt_sub")},
+	})
+	if err != nil {
+		abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not sign the token."))
+		return
+	}
+	c.PureJSON(http.StatusOK, gin.H{
+		"id":         dbUser.ID,
+		"token":      tokenString,
+		"token_type": "Bearer",
+		"expires_in": ImpersonationExpiration.Seconds(),
+		"scope":      joinScopes(scopes),
+	})
+}
+
+// findUser loads the user in the ":id" path parameter.
+// Aborts the request and returns false if there is none.
+func (uc *UserController) findUser(c *gin.Context) (db.User, bool) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	var dbUser = db.User{ID: uint(userId)}
+	session := uc.GetSession(c)
+	result := session.Limit(1).Find(&dbUser)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return dbUser, false
+	}
+	if result.RowsAffected == 0 {
+		abortWithProblem(c, NotFound())
+		return dbUser, false
+	}
+	return dbUser, true
+}
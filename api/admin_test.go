@@ -0,0 +1,181 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/gorm"
+)
+
+// createAdmin adds user "admin" with the admin role and returns its token
+func createAdmin(t *testing.T, database *gorm.DB) string {
+	admin := db.User{Username: "admin"}
+	if err := admin.SetPassword("adminpass1"); err != nil {
+		t.Fatal(err)
+	}
+	database.Create(&admin)
+	assert.Equal(t, db.PromoteAdmin(database, "admin"), nil)
+	token, err := GenerateJWT(admin.ID)
+	assert.Equal(t, err, nil)
+	return token
+}
+
+func TestAdminRequiresRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+
+	token, _ := GenerateJWT(1)
+	w := performAuthRequest(router, "GET", "/api/v1/admin/users", token, nil)
+	assert.Equal(t, 403, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+
+	// Tokens without the admin scope cannot administrate
+	scoped, _ := GenerateScopedJWT(2, []string{ScopeUsersRead})
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users", scoped, nil)
+	assert.Equal(t, 403, w.Code)
+
+	// Regular users only see the public profile
+	w = performAuthRequest(router, "GET", "/api/v1/users/2", token, nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, gin.H{"id": float64(2), "username": "admin"}, decodeBody(t, w.Body.Bytes()))
+}
+
+func TestAdminGetUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+
+	w := performAuthRequest(router, "GET", "/api/v1/admin/users?q=tes", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, float64(1), got["total"])
+	users := got["users"].([]interface{})
+	assert.Equal(t, "test", users[0].(map[string]interface{})["username"])
+	assert.Equal(t, "user", users[0].(map[string]interface{})["role"])
+
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users?page=2&page_size=1", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+	got = decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, float64(2), got["total"])
+	users = got["users"].([]interface{})
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, "admin", users[0].(map[string]interface{})["username"])
+
+	// "_" is not a wildcard
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users?q=t_st", adminToken, nil)
+	assert.Equal(t, float64(0), decodeBody(t, w.Body.Bytes())["total"])
+
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users?page_size=1000", adminToken, nil)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+	token, _ := GenerateJWT(1)
+
+	w := performAuthRequest(router, "POST", "/api/v1/admin/users/1/disable", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, true, decodeBody(t, w.Body.Bytes())["disabled"])
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 401, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 403, w.Code)
+
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/1/enable", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 200, w.Code)
+
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/2/disable", adminToken, nil)
+	assert.Equal(t, 409, w.Code)
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/99/disable", adminToken, nil)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestAdminPutRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+	token, _ := GenerateJWT(1)
+
+	w := performAuthRequest(router, "PUT", "/api/v1/admin/users/1/role", adminToken, jsonBody(t, gin.H{"role": "root"}))
+	assert.Equal(t, 400, w.Code)
+	w = performAuthRequest(router, "PUT", "/api/v1/admin/users/1/role", adminToken, jsonBody(t, gin.H{"role": "admin"}))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "admin", decodeBody(t, w.Body.Bytes())["role"])
+	// The role applies to tokens issued before
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users", token, nil)
+	assert.Equal(t, 200, w.Code)
+
+	w = performAuthRequest(router, "PUT", "/api/v1/admin/users/2/role", adminToken, jsonBody(t, gin.H{"role": "user"}))
+	assert.Equal(t, 409, w.Code)
+}
+
+func TestAdminForcePasswordReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	notifier := &recordingNotifier{}
+	previous := DefaultNotifier
+	DefaultNotifier = notifier
+	defer func() { DefaultNotifier = previous }()
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+
+	w := performAuthRequest(router, "POST", "/api/v1/admin/users/1/password-reset", adminToken, nil)
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, 1, len(notifier.messages))
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 403, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/password-reset/confirm", jsonBody(t, gin.H{
+		"token":        notifier.messages[0].Data["token"],
+		"new_password": "resetpass1",
+	}))
+	assert.Equal(t, 204, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "resetpass1"}))
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestAdminImpersonate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+
+	w := performAuthRequest(router, "POST", "/api/v1/admin/users/1/impersonate", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+	token := decodeBody(t, w.Body.Bytes())["token"].(string)
+	claims, err := ParseToken(token)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, "1", claims.Subject)
+	assert.Equal(t, "2", claims.Actor.Subject)
+
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 200, w.Code)
+	// Support cannot take over the account
+	w = performAuthRequest(router, "PUT", "/api/v1/users/1/password", token, jsonBody(t, gin.H{
+		"old_password": "testpass1",
+		"new_password": "newpass1",
+	}))
+	assert.Equal(t, 403, w.Code)
+
+	// Administrators cannot be impersonated
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/2/impersonate", adminToken, nil)
+	assert.Equal(t, 403, w.Code)
+}
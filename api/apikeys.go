@@ -0,0 +1,191 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyExpiration is the lifetime of API keys created without "expires_at"
+	APIKeyExpiration = 90 * 24 * time.Hour
+	// APIKeyMaxExpiration is the longest lifetime an API key can be created with
+	APIKeyMaxExpiration = 365 * 24 * time.Hour
+	// APIKeyPrefix starts every API key, so that leaked keys are easy to find
+	APIKeyPrefix = "gwi_"
+)
+
+// APIKeyLastUsedInterval limits how often the last use of a key is written.
+var APIKeyLastUsedInterval = time.Minute
+
+// ErrInvalidAPIKey is returned for unknown, expired or orphaned API keys.
+var ErrInvalidAPIKey = errors.New("invalid or expired API key")
+
+// APIKeyStore looks up API keys presented by requests.
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyStore(database *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: database}
+}
+
+// Authenticate finds the API key `key` of a user, that is neither in the trash
+// nor disabled, and records its use.
+func (s *APIKeyStore) Authenticate(key string) (*db.APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	var apiKey db.APIKey
+	result := s.db.
+		Joins("JOIN users ON users.id = api_keys.user_id AND users.deleted_at IS NULL AND NOT users.disabled").
+		Where("api_keys.key_hash = ? AND api_keys.expires_at > ?", hashAPIKey(key), time.Now()).
+		Limit(1).Find(&apiKey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > APIKeyLastUsedInterval {
+		result = s.db.Model(&apiKey).Update("last_used_at", now)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+	}
+	return &apiKey, nil
+}
+
+// APIKey is the API representation of a key. `Key` is only set on creation.
+type APIKey struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKey(dbKey db.APIKey) APIKey {
+	return APIKey{
+		ID:         dbKey.ID,
+		Name:       dbKey.Name,
+		Prefix:     dbKey.Prefix,
+		Scopes:     splitScopes(dbKey.Scopes),
+		ExpiresAt:  dbKey.ExpiresAt,
+		LastUsedAt: dbKey.LastUsedAt,
+		CreatedAt:  dbKey.CreatedAt,
+	}
+}
+
+// POST /users/:id/api-keys
+// PostAPIKey creates an API key. The key is returned only in this response.
+func (uc *UserController) PostAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	userId, _ := strconv.Atoi(id)
+	if err := VerifyID(c, userId); err != nil {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	var apiRequest APIKeyRequest
+	if err := c.ShouldBindJSON(&apiRequest); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	now := time.Now()
+	expiresAt := now.Add(APIKeyExpiration)
+	if apiRequest.ExpiresAt != nil {
+		expiresAt = *apiRequest.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(APIKeyMaxExpiration)) {
+		abortWithProblem(c, NewProblem(http.StatusBadRequest,
+			fmt.Sprintf("The key has to expire within %d days.", int(APIKeyMaxExpiration.Hours()/24))))
+		return
+	}
+
+	secret, err := randomURLString(32)
+	if err != nil {
+		abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not create API key."))
+		return
+	}
+	key := APIKeyPrefix + secret
+	dbKey := db.APIKey{
+		UserID:    uint(userId),
+		Name:      apiRequest.Name,
+		Prefix:    key[:len(APIKeyPrefix)+8],
+		KeyHash:   hashAPIKey(key),
+		Scopes:    joinScopes(apiRequest.Scopes),
+		ExpiresAt: expiresAt,
+	}
+	session := uc.GetSession(c)
+	if result := session.Create(&dbKey); result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	response := newAPIKey(dbKey)
+	response.Key = key
+	c.Header("Location", fmt.Sprintf("/api/v1/users/%d/api-keys/%d", userId, dbKey.ID))
+	c.PureJSON(http.StatusCreated, response)
+}
+
+// GET /users/:id/api-keys
+func (uc *UserController) GetAPIKeys(c *gin.Context) {
+	id := c.Param("id")
+	userId, _ := strconv.Atoi(id)
+	if err := VerifyID(c, userId); err != nil {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	var dbKeys []db.APIKey
+	session := uc.GetSession(c)
+	result := session.Where("user_id = ?", userId).Order("id").Find(&dbKeys)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	keys := make([]APIKey, len(dbKeys))
+	for i, dbKey := range dbKeys {
+		keys[i] = newAPIKey(dbKey)
+	}
+	c.PureJSON(http.StatusOK, keys)
+}
+
+// DELETE /users/:id/api-keys/:keyId
+// DeleteAPIKey revokes an API key.
+func (uc *UserController) DeleteAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	userId, _ := strconv.Atoi(id)
+	if err := VerifyID(c, userId); err != nil {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	keyId, _ := strconv.Atoi(c.Param("keyId"))
+	session := uc.GetSession(c)
+	result := session.Where("id = ? AND user_id = ?", keyId, userId).Delete(&db.APIKey{})
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithProblem(c, NotFound())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func performKeyRequest(r http.Handler, method, path, header, value string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set(header, value)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	w := performAuthRequest(router, "POST", "/api/v1/users/1/api-keys", token, jsonBody(t, gin.H{
+		"name":   "etl",
+		"scopes": []string{ScopeAssetsRead},
+	}))
+	assert.Equal(t, 201, w.Code)
+	created := decodeBody(t, w.Body.Bytes())
+	key := created["key"].(string)
+
+	w = performKeyRequest(router, "GET", "/api/v1/assets", "X-API-Key", key)
+	assert.Equal(t, 200, w.Code)
+	w = performKeyRequest(router, "GET", "/api/v1/assets", "Authorization", "ApiKey "+key)
+	assert.Equal(t, 200, w.Code)
+	// Outside of the granted scopes
+	w = performKeyRequest(router, "POST", "/api/v1/assets", "X-API-Key", key)
+	assert.Equal(t, 403, w.Code)
+	w = performKeyRequest(router, "GET", "/api/v1/users/1/api-keys", "X-API-Key", key)
+	assert.Equal(t, 403, w.Code)
+
+	// Listing does not reveal the key but shows its use
+	w = performAuthRequest(router, "GET", "/api/v1/users/1/api-keys", token, nil)
+	assert.Equal(t, 200, w.Code)
+	var listed []APIKey
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(listed))
+	assert.Equal(t, "", listed[0].Key)
+	assert.Equal(t, "etl", listed[0].Name)
+	assert.NotEqual(t, nil, listed[0].LastUsedAt)
+
+	w = performAuthRequest(router, "DELETE", "/api/v1/users/1/api-keys/1", token, nil)
+	assert.Equal(t, 204, w.Code)
+	w = performKeyRequest(router, "GET", "/api/v1/assets", "X-API-Key", key)
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestAPIKeyValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token, _ := GenerateJWT(1)
+
+	for _, payload := range []gin.H{
+		{"name": "etl"},
+		{"name": "etl", "scopes": []string{"unknown"}},
+		{"name": "etl", "scopes": []string{ScopeAccount}},
+		{"name": "etl", "scopes": []string{ScopeAssetsRead}, "expires_at": time.Now().Add(-time.Hour)},
+		{"name": "etl", "scopes": []string{ScopeAssetsRead}, "expires_at": time.Now().Add(2 * APIKeyMaxExpiration)},
+	} {
+		w := performAuthRequest(router, "POST", "/api/v1/users/1/api-keys", token, jsonBody(t, payload))
+		assert.Equal(t, 400, w.Code)
+	}
+	// Keys are created for the own user only
+	w := performAuthRequest(router, "POST", "/api/v1/users/2/api-keys", token, jsonBody(t, gin.H{
+		"name":   "etl",
+		"scopes": []string{ScopeAssetsRead},
+	}))
+	assert.Equal(t, 403, w.Code)
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token, _ := GenerateJWT(1)
+
+	w := performAuthRequest(router, "POST", "/api/v1/users/1/api-keys", token, jsonBody(t, gin.H{
+		"name":   "etl",
+		"scopes": []string{ScopeAssetsRead},
+	}))
+	key := decodeBody(t, w.Body.Bytes())["key"].(string)
+
+	database.Model(&db.APIKey{}).Where("id = ?", 1).Update("expires_at", time.Now().Add(-time.Second))
+	w = performKeyRequest(router, "GET", "/api/v1/assets", "X-API-Key", key)
+	assert.Equal(t, 401, w.Code)
+
+	// Keys of deleted users stop working
+	database.Model(&db.APIKey{}).Where("id = ?", 1).Update("expires_at", time.Now().Add(time.Hour))
+	w = performKeyRequest(router, "GET", "/api/v1/assets", "X-API-Key", key)
+	assert.Equal(t, 200, w.Code)
+	database.Delete(&db.User{ID: 1})
+	w = performKeyRequest(router, "GET", "/api/v1/assets", "X-API-Key", key)
+	assert.Equal(t, 401, w.Code)
+}
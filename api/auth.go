@@ -1,51 +1,142 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 )
 
-// TODO: change into a certificate file bytes
-var jwtKey = []byte("supersecretkey")
+// TokenExpiration is the lifetime of access tokens.
+var TokenExpiration = 1 * time.Hour
 
-const TokenExpiration = 1 * time.Hour
+func init() {
+	// Token revocation compares issue times, which must be more precise than
+	// a second, so that a token issued right after revocation stays valid.
+	jwt.TimePrecision = time.Microsecond
+}
+
+// AccessAudience is the "aud" of access tokens. Tokens with any other
+// audience, e.g. challenge tokens, are not accepted by `AuthMiddleware`.
+const AccessAudience = "access"
+
+// MFAAudience is the "aud" of challenge tokens returned by `PostToken` for users
+// with two-factor authentication. These tokens cannot be used for access.
+const MFAAudience = "mfa"
+
+const MFATokenExpiration = 5 * time.Minute
 
-// GenerateJWT creates a JWT token using `jwtKey` that is valid
-// for the duration of `TokenExpiration`.
+// Claims of the tokens issued by the api. "scope" holds the space separated
+// scopes granted to the token, see RFC 8693.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"`
+	// Actor is set on tokens of an administrator impersonating the subject
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Actor identifies who acts on behalf of the subject, see RFC 8693.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Scopes returns the scopes granted to the token. Tokens without the "scope"
+// claim are granted none.
+func (c *Claims) Scopes() []string {
+	return splitScopes(c.Scope)
+}
+
+// GenerateJWT creates a JWT token signed by the active key of `jwtKeys` that is valid
+// for the duration of `TokenExpiration` and grants all scopes. Every token gets
+// a unique "jti", so that it can be revoked.
 // Returns the jwt string and error, if there was problem signing the key.
 func GenerateJWT(userId uint) (tokenString string, err error) {
-	expirationTime := time.Now().Add(TokenExpiration)
-	claims := &jwt.StandardClaims{
-		Subject:   strconv.FormatUint(uint64(userId), 10),
-		ExpiresAt: expirationTime.Unix(),
+	return GenerateScopedJWT(userId, AllScopes)
+}
+
+// GenerateScopedJWT creates a token like `GenerateJWT`, that grants only `scopes`.
+func GenerateScopedJWT(userId uint, scopes []string) (tokenString string, err error) {
+	return generateToken(userId, TokenExpiration, jwt.ClaimStrings{AccessAudience}, scopes)
+}
+
+// GenerateMFAToken creates a challenge token valid for `MFATokenExpiration`,
+// that can be exchanged for an access token with `scopes` together with a TOTP code.
+func GenerateMFAToken(userId uint, scopes []string) (tokenString string, err error) {
+	return generateToken(userId, MFATokenExpiration, jwt.ClaimStrings{MFAAudience}, scopes)
+}
+
+func generateToken(userId uint, expiration time.Duration, audience jwt.ClaimStrings, scopes []string) (string, error) {
+	tokenId, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Subject:   strconv.FormatUint(uint64(userId), 10),
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		},
+		Scope: joinScopes(scopes),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err = token.SignedString(jwtKey)
-	return
+	return jwtKeys.Sign(claims)
 }
 
-// ParseToken parses `signedToken` into claims struct.
-// Returns pointer to StandardClaims struct and error, if there was problem with parsing.
-func ParseToken(signedToken string) (*jwt.StandardClaims, error) {
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// ParseToken parses access token `signedToken` into claims struct.
+// Returns pointer to Claims struct and error, if there was problem with parsing.
+func ParseToken(signedToken string) (*Claims, error) {
+	claims, err := parseClaims(signedToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.VerifyAudience(MFAAudience, true) {
+		return nil, errors.New("two-factor authentication is not complete")
+	}
+	if !claims.VerifyAudience(AccessAudience, true) {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+// ParseMFAToken parses challenge token `signedToken` created by `GenerateMFAToken`.
+func ParseMFAToken(signedToken string) (*Claims, error) {
+	claims, err := parseClaims(signedToken)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyAudience(MFAAudience, true) {
+		return nil, errors.New("not a two-factor authentication challenge")
+	}
+	return claims, nil
+}
+
+func parseClaims(signedToken string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
-		&jwt.StandardClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtKey), nil
-		},
+		&Claims{},
+		jwtKeys.Keyfunc,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse Claims interface into StandardClaims
-	claims, ok := token.Claims.(*jwt.StandardClaims)
+	// Parse Claims interface into Claims
+	claims, ok := token.Claims.(*Claims)
 	if !ok {
 		err = errors.New("could not parse claims")
 		return nil, err
@@ -73,47 +164,78 @@ func VerifyID(c *gin.Context, id int) error {
 }
 
 // AuthMiddleware provides a handler function that checks for "Authorization" header
-// to be a valid Bearer JWT token.
-// The handler function aborts with 401 status if there is a problem with the token.
-func AuthMiddleware() gin.HandlerFunc {
+// to be a valid Bearer JWT token that was not revoked in `revocations`, or for an
+// API key in `apiKeys` in "X-API-Key" or "Authorization: ApiKey" header.
+// Without these headers, a verified TLS client certificate linked to a user in
+// `clientCerts` authenticates the request.
+// The handler function aborts with 401 status if there is a problem with the credential.
+func AuthMiddleware(revocations *RevocationStore, apiKeys *APIKeyStore, clientCerts *ClientCertStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
+		apiKey := c.GetHeader("X-API-Key")
+		if strings.HasPrefix(tokenString, "ApiKey ") {
+			apiKey = strings.TrimSpace(strings.TrimPrefix(tokenString, "ApiKey "))
+		}
+		if cert := verifiedClientCert(c); cert != nil && tokenString == "" && apiKey == "" {
+			userId, err := clientCerts.Authenticate(cert)
+			if errors.Is(err, ErrUnknownClientCert) {
+				abortWithProblem(c, Unauthorized("Client certificate is not linked to a user."))
+				return
+			}
+			if err != nil {
+				abortWithProblem(c, DBProblem(err))
+				return
+			}
+			c.Set("jwt_sub", strconv.FormatUint(uint64(userId), 10))
+			c.Set(scopesKey, ClientCertScopes)
+			c.Next()
+			return
+		}
+		if apiKey != "" {
+			dbKey, err := apiKeys.Authenticate(apiKey)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				abortWithProblem(c, Unauthorized("Invalid or expired API key."))
+				return
+			}
+			if err != nil {
+				abortWithProblem(c, DBProblem(err))
+				return
+			}
+			c.Set("jwt_sub", strconv.FormatUint(uint64(dbKey.UserID), 10))
+			c.Set(scopesKey, splitScopes(dbKey.Scopes))
+			c.Next()
+			return
+		}
+
 		if tokenString == "" {
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"error":   "Unauthorized",
-					"message": "No Access token provided.",
-				},
-			)
+			abortWithProblem(c, Unauthorized("No Access token provided."))
 			return
 		}
 		splitToken := strings.Split(tokenString, "Bearer")
 		if len(splitToken) != 2 {
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"error":   "Unauthorized",
-					"message": "Invalid bearer token format.",
-				},
-			)
+			abortWithProblem(c, Unauthorized("Invalid bearer token format."))
 			return
 		}
 		tokenString = strings.TrimSpace(splitToken[1])
 
 		claims, err := ParseToken(tokenString)
 		if err != nil {
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"error":   "Unauthorized",
-					"message": err.Error(),
-				},
-			)
+			abortWithProblem(c, Unauthorized(err.Error()))
+			return
+		}
+		revoked, err := revocations.IsRevoked(&claims.RegisteredClaims)
+		if err != nil {
+			abortWithProblem(c, DBProblem(err))
+			return
+		}
+		if revoked {
+			abortWithProblem(c, Unauthorized("Token has been revoked."))
 			return
 		}
 		// Set this key for scope authorizat
 		c.Set("jwt_sub", claims.Subject)
+		c.Set("jwt_claims", claims)
+		c.Set(scopesKey, claims.Scopes())
 		c.Next()
 	}
 }
@@ -2,6 +2,9 @@ package api
 
 import (
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
 // TestGenerateJWT calls api.GenerateJWT with and id checking,
@@ -14,3 +17,20 @@ func TestGenerateJWT(t *testing.T) {
 		t.Fatalf(`GenerateJWT(uint(0)) = %q, %v, parseErr: %v`, token, err, parseErr)
 	}
 }
+
+// TestParseTokenAudience checks, that only access tokens are accepted.
+func TestParseTokenAudience(t *testing.T) {
+	token, err := GenerateMFAToken(1, nil)
+	if _, parseErr := ParseToken(token); err != nil || parseErr == nil {
+		t.Fatalf(`ParseToken(challenge token) = %v, err: %v`, parseErr, err)
+	}
+	now := time.Now()
+	token, err = jwtKeys.Sign(&jwt.RegisteredClaims{
+		Subject:   "1",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	})
+	if _, parseErr := ParseToken(token); err != nil || parseErr == nil {
+		t.Fatalf(`ParseToken(token without audience) = %v, err: %v`, parseErr, err)
+	}
+}
@@ -15,81 +15,68 @@ import (
 type UserController struct {
 	db            *gorm.DB
 	SessionConfig *gorm.Session
+	limiter       *LoginLimiter
+	resetLimiter  *LoginLimiter
+	revocations   *RevocationStore
+	notifier      Notifier
+	oidc          *OIDCProvider
 }
 
-func (uc *UserController) GetSession() *gorm.DB {
-	return uc.db.Session(uc.SessionConfig)
+// GetSession returns a session bound to the context of the request, so that
+// statements are traced as part of it.
+func (uc *UserController) GetSession(c *gin.Context) *gorm.DB {
+	return uc.db.Session(uc.SessionConfig).WithContext(c.Request.Context())
 }
 
 // POST /token
 func (uc *UserController) PostToken(c *gin.Context) {
-	var apiUser User
-	if err := c.ShouldBindJSON(&apiUser); err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+	var credentials TokenRequest
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
-
-	dbUser, err := apiUser.getDBUser()
-	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+	if retryAfter := uc.limiter.RetryAfter(credentials.Username, c.ClientIP()); retryAfter > 0 {
+		abortTooManyRequests(c, retryAfter)
 		return
 	}
-	session := uc.GetSession()
-	result := session.Limit(1).Find(&dbUser)
+
+	var dbUser db.User
+	session := uc.GetSession(c)
+	result := session.Where("username = ?", credentials.Username).Limit(1).Find(&dbUser)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.AbortWithStatusJSON(
-			http.StatusUnauthorized,
-			gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid credentials",
-			},
-		)
+	if result.RowsAffected == 0 || dbUser.CheckPassword(credentials.Password) != nil {
+		uc.limiter.Failure(credentials.Username, c.ClientIP())
+		abortWithProblem(c, Unauthorized("Invalid credentials."))
 		return
 	}
-
-	credentialError := dbUser.CheckPassword(apiUser.Password)
-	if credentialError != nil {
-		c.AbortWithStatusJSON(
-			http.StatusUnauthorized,
-			gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid credentials",
-			},
-		)
+	uc.limiter.Success(credentials.Username)
+	if dbUser.Disabled {
+		abortWithProblem(c, accountDisabled())
+		return
+	}
+	if dbUser.MustResetPassword {
+		abortWithProblem(c, NewProblem(http.StatusForbidden, "Password has to be reset."))
+		return
+	}
+	scopes := credentials.Scopes
+	if len(scopes) == 0 {
+		scopes = AllScopes
+	}
+	if dbUser.TOTPEnabled {
+		respondWithMFAChallenge(c, dbUser, scopes)
 		return
 	}
+	respondWithToken(c, dbUser, scopes)
+}
 
-	tokenString, err := GenerateJWT(dbUser.ID)
+// respondWithToken issues a new token for `dbUser` granting `scopes`.
+func respondWithToken(c *gin.Context, dbUser db.User, scopes []string) {
+	tokenString, err := GenerateScopedJWT(dbUser.ID, scopes)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusUnauthorized,
-			gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid credentials",
-			},
-		)
+		abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not sign the token."))
 		return
 	}
 	c.PureJSON(http.StatusOK, gin.H{
@@ -97,6 +84,7 @@ func (uc *UserController) PostToken(c *gin.Context) {
 		"token":      tokenString,
 		"token_type": "Bearer",
 		"expires_in": TokenExpiration.Seconds(),
+		"scope":      joinScopes(scopes),
 	})
 }
 
@@ -105,48 +93,34 @@ func (uc *UserController) PostUsers(c *gin.Context) {
 	var apiUser User
 
 	if err := c.ShouldBindJSON(&apiUser); err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
 	dbUser, err := apiUser.getDBUser()
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid inputs",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	result := session.Create(&dbUser)
+	if result.Error != nil && isUniqueViolation(result.Error) {
+		abortWithProblem(c, Conflict("Username is already taken."))
+		return
+	}
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		urlPath := c.Request.URL.Path
 		paths := append([]string{urlPath}, fmt.Sprint(dbUser.ID))
 		urlPath = path.Join(paths...)
 		c.Header("Location", urlPath)
-		c.PureJSON(http.StatusCreated, dbUser)
+		c.PureJSON(http.StatusCreated, newPublicUser(dbUser))
 		return
 	}
 }
@@ -155,23 +129,21 @@ func (uc *UserController) PostUsers(c *gin.Context) {
 func (uc *UserController) GetUsers(c *gin.Context) {
 	var dbUsers []db.User
 
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	result := session.Find(&dbUsers)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
-		c.PureJSON(http.StatusOK, dbUsers)
+		users := make([]PublicUser, len(dbUsers))
+		for i, dbUser := range dbUsers {
+			users[i] = newPublicUser(dbUser)
+		}
+		c.PureJSON(http.StatusOK, users)
 		return
 	}
 }
@@ -182,26 +154,23 @@ func (uc *UserController) GetUserByID(c *gin.Context) {
 	userId, _ := strconv.Atoi(id)
 	var dbUser = db.User{ID: uint(userId)}
 
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	// Prevent ErrRecordNotFound
 	result := session.Limit(1).Find(&dbUser)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
-	} else {
-		c.PureJSON(http.StatusOK, dbUser)
+	}
+	// Users see their complete profile, others only the public part
+	if VerifyID(c, userId) == nil {
+		c.PureJSON(http.StatusOK, newProfile(dbUser))
 		return
 	}
+	c.PureJSON(http.StatusOK, newPublicUser(dbUser))
 }
 
 // DELETE /users/:id
@@ -211,31 +180,24 @@ func (uc *UserController) DeleteUserByID(c *gin.Context) {
 	userId, _ := strconv.Atoi(id)
 	err := VerifyID(c, userId)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusForbidden,
-			gin.H{
-				"error":   "Forbidden",
-				"message": "You do not have access to this resource.",
-			},
-		)
+		abortWithProblem(c, Forbidden())
 		return
 	}
 	var dbUser = db.User{ID: uint(userId)}
 
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	result := session.Delete(&dbUser)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
+		return
+	}
+	// Deleted user must not keep using the tokens issued so far
+	if err := uc.revocations.RevokeUser(dbUser.ID); err != nil {
+		abortWithProblem(c, DBProblem(err))
 		return
 	} else {
 		c.Status(http.StatusNoContent)
@@ -250,13 +212,7 @@ func (uc *UserController) PostFavourites(c *gin.Context) {
 	userId, _ := strconv.Atoi(id)
 	err := VerifyID(c, userId)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusForbidden,
-			gin.H{
-				"error":   "Forbidden",
-				"message": "You do not have access to this resource.",
-			},
-		)
+		abortWithProblem(c, Forbidden())
 		return
 	}
 	var dbUser = db.User{ID: uint(userId)}
@@ -264,38 +220,31 @@ func (uc *UserController) PostFavourites(c *gin.Context) {
 	var apiFavourite Favourite
 
 	if err := c.ShouldBindJSON(&apiFavourite); err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
 	dbAsset, err := apiFavourite.getDBAsset()
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid inputs",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	session := uc.GetSession(c)
+	// Trashed and missing assets cannot become favourites
+	var existing []db.Asset
+	result := session.Where("id = ?", dbAsset.ID).Limit(1).Find(&existing)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if len(existing) == 0 {
+		abortWithProblem(c, NotFound())
 		return
 	}
-	session := uc.GetSession()
 
 	err = session.Preload(clause.Associations).Model(&dbUser).Association("Favourites").Append(&dbAsset)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(err))
 		return
 	} else {
 		urlPath := c.Request.URL.Path
@@ -313,33 +262,21 @@ func (uc *UserController) GetFavourites(c *gin.Context) {
 	userId, _ := strconv.Atoi(id)
 	err := VerifyID(c, userId)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusForbidden,
-			gin.H{
-				"error":   "Forbidden",
-				"message": "You do not have access to this resource.",
-			},
-		)
+		abortWithProblem(c, Forbidden())
 		return
 	}
 	var dbUser = db.User{ID: uint(userId)}
 	var dbAssets []*db.Asset
 
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	// Prevent ErrRecordNotFound
 	err = session.Preload(clause.Associations).Model(&dbUser).Association("Favourites").Find(&dbAssets)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(err))
 		return
 	}
 	if len(dbAssets) == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		c.PureJSON(http.StatusOK, dbAssets)
@@ -353,13 +290,7 @@ func (uc *UserController) GetFavouriteByID(c *gin.Context) {
 	userId, _ := strconv.Atoi(id)
 	err := VerifyID(c, userId)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusForbidden,
-			gin.H{
-				"error":   "Forbidden",
-				"message": "You do not have access to this resource.",
-			},
-		)
+		abortWithProblem(c, Forbidden())
 		return
 	}
 	favId := c.Param("favId")
@@ -367,22 +298,19 @@ func (uc *UserController) GetFavouriteByID(c *gin.Context) {
 	var dbUser = db.User{ID: uint(userId)}
 	var dbAssets []*db.Asset
 
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	// Prevent ErrRecordNotFound
 	// Load only assets that belong to the user and have the correct id (which should be 0 or 1)
-	result := session.Debug().Model(&db.Asset{ID: uint(assetId)}).Joins("INNER JOIN user_assets ua ON ua.asset_id = assets.id AND ua.user_id = ?", dbUser.ID).Preload(clause.Associations).Find(&dbAssets)
+	result := session.Model(&db.Asset{}).
+		Joins("INNER JOIN user_assets ua ON ua.asset_id = assets.id AND ua.user_id = ?", dbUser.ID).
+		Where("assets.id = ?", assetId).
+		Preload(clause.Associations).Find(&dbAssets)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		c.PureJSON(http.StatusOK, dbAssets[0])
@@ -396,13 +324,7 @@ func (uc *UserController) DeleteFavouriteByID(c *gin.Context) {
 	userId, _ := strconv.Atoi(id)
 	err := VerifyID(c, userId)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusForbidden,
-			gin.H{
-				"error":   "Forbidden",
-				"message": "You do not have access to this resource.",
-			},
-		)
+		abortWithProblem(c, Forbidden())
 		return
 	}
 	favId := c.Param("favId")
@@ -410,16 +332,10 @@ func (uc *UserController) DeleteFavouriteByID(c *gin.Context) {
 	var dbUser = db.User{ID: uint(userId)}
 	var dbAsset = db.Asset{ID: uint(assetId)}
 
-	session := uc.GetSession()
+	session := uc.GetSession(c)
 	err = session.Model(&dbUser).Association("Favourites").Delete(&dbAsset)
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(err))
 		return
 	} else {
 		c.Status(http.StatusNoContent)
@@ -432,28 +348,22 @@ type AssetController struct {
 	SessionConfig *gorm.Session
 }
 
-func (ac *AssetController) GetSession() *gorm.DB {
-	return ac.db.Session(ac.SessionConfig)
+func (ac *AssetController) GetSession(c *gin.Context) *gorm.DB {
+	return ac.db.Session(ac.SessionConfig).WithContext(c.Request.Context())
 }
 
 // GET /assets
 func (ac *AssetController) GetAssets(c *gin.Context) {
 	var dbAssets []db.Asset
 
-	session := ac.GetSession()
+	session := ac.GetSession(c)
 	result := session.Preload(clause.Associations).Preload("Audience.Characteristics").Find(&dbAssets)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		c.PureJSON(http.StatusOK, dbAssets)
@@ -466,37 +376,19 @@ func (ac *AssetController) PostAssets(c *gin.Context) {
 	var apiAsset Asset
 
 	if err := c.ShouldBindJSON(&apiAsset); err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
 	dbAsset, err := apiAsset.getDBAsset()
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid inputs",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
-	session := ac.GetSession()
+	session := ac.GetSession(c)
 	result := session.Create(&dbAsset)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	} else {
 		urlPath := c.Request.URL.Path
@@ -514,21 +406,15 @@ func (ac *AssetController) GetAssetByID(c *gin.Context) {
 	assetId, _ := strconv.Atoi(id)
 	var dbAsset = db.Asset{ID: uint(assetId)}
 
-	session := ac.GetSession()
+	session := ac.GetSession(c)
 	// Prevent ErrRecordNotFound
 	result := session.Preload(clause.Associations).Preload("Audience.Characteristics").Find(&dbAsset)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		c.PureJSON(http.StatusOK, dbAsset)
@@ -543,42 +429,34 @@ func (ac *AssetController) PutAssetByID(c *gin.Context) {
 	var apiAsset Asset
 
 	if err := c.ShouldBindJSON(&apiAsset); err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
 	dbAsset, err := apiAsset.getDBAsset()
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid inputs",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
-	session := ac.GetSession()
-	result := session.Where(db.Asset{ID: uint(assetId)}).FirstOrCreate(&dbAsset)
+	session := ac.GetSession(c)
+	var trashed int64
+	result := session.Unscoped().Model(&db.Asset{}).Where("id = ? AND deleted_at IS NOT NULL", assetId).Count(&trashed)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if trashed > 0 {
+		abortWithProblem(c, AssetInTrash())
+		return
+	}
+	result = session.Where(db.Asset{ID: uint(assetId)}).FirstOrCreate(&dbAsset)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		urlPath := c.Request.URL.Path
@@ -597,44 +475,26 @@ func (ac *AssetController) PatchAssetByID(c *gin.Context) {
 	var apiAsset Asset
 
 	if err := c.ShouldBindJSON(&apiAsset); err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid input",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
 	newDbAsset, err := apiAsset.getDBAsset()
 	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "Invalid inputs",
-			},
-		)
+		abortWithProblem(c, InvalidInput(c, err))
 		return
 	}
 
-	session := ac.GetSession()
+	session := ac.GetSession(c)
 	// Get asset from db, modify changed fields, save
 	dbAsset := db.Asset{ID: uint(assetId)}
 	result := session.Preload(clause.Associations).Preload("Audience.Characteristics").Find(&dbAsset)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	}
 
@@ -661,17 +521,11 @@ func (ac *AssetController) PatchAssetByID(c *gin.Context) {
 
 	result = session.Session(&gorm.Session{FullSaveAssociations: true}).Save(&dbAsset)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		urlPath := c.Request.URL.Path
@@ -689,20 +543,14 @@ func (ac *AssetController) DeleteAssetByID(c *gin.Context) {
 	assetId, _ := strconv.Atoi(id)
 	dbAsset := db.Asset{ID: uint(assetId)}
 
-	session := ac.GetSession()
+	session := ac.GetSession(c)
 	result := session.Delete(&dbAsset)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{
-				"error":   result.Error.Error(),
-				"message": "DB problem.",
-			},
-		)
+		abortWithProblem(c, DBProblem(result.Error))
 		return
 	}
 	if result.RowsAffected == 0 {
-		c.Status(http.StatusNotFound)
+		abortWithProblem(c, NotFound())
 		return
 	} else {
 		c.Status(http.StatusNoContent)
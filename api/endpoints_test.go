@@ -29,6 +29,20 @@ func initDB() *gorm.DB {
 
 func performRequest(r http.Handler, method, path string, body io.ReadCloser) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest(method, path, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func performAuthRequest(r http.Handler, method, path, token string, body io.ReadCloser) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	return w
@@ -126,3 +140,22 @@ func TestGetUserByID(t *testing.T) {
 }
 
 // TODO: test all endpoints
+
+func TestGetFavouriteByID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token, _ := GenerateJWT(1)
+
+	for _, id := range []int{2, 3} {
+		w := performAuthRequest(router, "POST", "/api/v1/users/1/favourites", token, jsonBody(t, gin.H{"id": id}))
+		assert.Equal(t, 201, w.Code)
+	}
+	w := performAuthRequest(router, "GET", "/api/v1/users/1/favourites/3", token, nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, float64(3), decodeBody(t, w.Body.Bytes())["id"])
+	// Assets that are not favourites are not found
+	w = performAuthRequest(router, "GET", "/api/v1/users/1/favourites/1", token, nil)
+	assert.Equal(t, 404, w.Code)
+}
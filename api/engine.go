@@ -1,57 +1,174 @@
 package api
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 // CreateTestEngine creates an engine similar to `CreateEngine` but turns off
-// authentication middleware for testing purposes.
+// authentication middleware for testing purposes. Requests and responses
+// are always checked against the OpenAPI document, see `OpenAPIValidator`.
 func CreateTestEngine(db *gorm.DB, useAuth bool) *gin.Engine {
-	return createEngine(db, useAuth)
+	return createEngine(db, useAuth, true)
 }
 
 // CreateEngine configures gin engine, sets routes for api paths and adds
 // authentication middleware.
 func CreateEngine(db *gorm.DB) *gin.Engine {
-	return createEngine(db, true)
+	return createEngine(db, true, ValidateRequests)
 }
 
+// TrustedProxies are the addresses or CIDRs of reverse proxies, whose
+// "X-Forwarded-For" and "X-Real-IP" headers name the client IP used by the
+// login limits and logs. No proxy is trusted by default, so that clients
+// cannot choose their IP.
+var TrustedProxies []string
+
 // See `CreateEngine`
-func createEngine(db *gorm.DB, useAuth bool) *gin.Engine {
-	engine := gin.Default()
-	uc := UserController{db: db, SessionConfig: &gorm.Session{}}
+func createEngine(db *gorm.DB, useAuth bool, validate bool) *gin.Engine {
+	registerValidations()
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(TrustedProxies); err != nil {
+		panic(err)
+	}
+	engine.Use(RequestIDMiddleware(), TracingMiddleware(), LoggerMiddleware(), MetricsMiddleware(), RecoveryMiddleware())
+	engine.Use(ErrorHandler())
+	engine.NoRoute(func(c *gin.Context) {
+		abortWithProblem(c, NotFound())
+	})
+	// Added to the groups, so that requests are authenticated first
+	var validation []gin.HandlerFunc
+	if validate {
+		validator, err := OpenAPIValidator()
+		if err != nil {
+			panic(err)
+		}
+		validation = append(validation, validator)
+	}
+
+	operations := engine.Group("", validation...)
+	// Public keys for verification of our tokens by other services
+	operations.GET("/.well-known/jwks.json", GetJWKS)
+
+	// Probes of the orchestrator, without authentication
+	hc := &HealthController{db: db}
+	operations.GET("/healthz", hc.Healthz)
+	operations.GET("/readyz", hc.Readyz)
+	operations.GET("/status", hc.Status)
+	for _, plugin := range []gorm.Plugin{DBMetrics{}, DBTracing{}} {
+		if err := db.Use(plugin); err != nil && !errors.Is(err, gorm.ErrRegistered) {
+			panic(err)
+		}
+	}
+	operations.GET("/metrics", Metrics(db))
+
+	// Documentation of the API
+	operations.GET("/openapi.json", GetOpenAPI)
+	operations.GET("/docs/*filepath", SwaggerUI)
+
+	revocations := NewRevocationStore(db)
+	uc := UserController{
+		db:            db,
+		SessionConfig: &gorm.Session{},
+		limiter:       NewLoginLimiter(DefaultLoginLimits),
+		resetLimiter:  NewLoginLimiter(DefaultResetLimits),
+		revocations:   revocations,
+		notifier:      DefaultNotifier,
+		oidc:          DefaultOIDCProvider,
+	}
 	ac := AssetController{db: db, SessionConfig: &gorm.Session{}}
+	gc, err := NewGraphQLController(db)
+	if err != nil {
+		panic(err)
+	}
 
 	// Allow user creation without authorization
-	insecure := engine.Group("/api/v1")
+	insecure := engine.Group("/api/v1", validation...)
 	// TODO: token refresh endpoint
 	insecure.POST("/users", uc.PostUsers)
 	insecure.POST("/token", uc.PostToken)
+	insecure.POST("/token/mfa", uc.PostMFAToken)
+	insecure.POST("/users/restore", uc.RestoreUser)
+	insecure.POST("/password-reset", uc.RequestPasswordReset)
+	insecure.POST("/password-reset/confirm", uc.ConfirmPasswordReset)
+	insecure.POST("/email-verification/confirm", uc.ConfirmEmailVerification)
+	if uc.oidc != nil {
+		insecure.GET("/oidc/login", uc.OIDCLogin)
+		insecure.GET("/oidc/callback", uc.OIDCCallback)
+	}
 
-	// Require JWT token for this group
+	// Require JWT token, API key or client certificate for this group
 	secure := engine.Group("/api/v1")
 	if useAuth {
-		secure.Use(AuthMiddleware())
+		secure.Use(AuthMiddleware(revocations, NewAPIKeyStore(db), NewClientCertStore(db)))
+	} else {
+		// Requests of tests without authentication are not limited
+		secure.Use(func(c *gin.Context) {
+			c.Set(scopesKey, AllScopes)
+		})
 	}
+	// Requests are validated once authenticated and authorized for `scopes`
+	scoped := func(scopes ...string) *gin.RouterGroup {
+		return secure.Group("", append([]gin.HandlerFunc{RequireScopes(scopes...)}, validation...)...)
+	}
+	scoped().POST("/logout", uc.Logout)
+
+	// Account management, which API keys are never granted
+	account := scoped(ScopeAccount)
+	account.PATCH("/users/:id", uc.PatchUserByID)
+	account.DELETE("/users/:id", uc.DeleteUserByID)
+	account.PUT("/users/:id/password", uc.ChangePassword)
+	account.POST("/users/:id/totp", uc.EnrollTOTP)
+	account.POST("/users/:id/totp/verify", uc.VerifyTOTP)
+	account.DELETE("/users/:id/totp", uc.DisableTOTP)
+	account.GET("/users/:id/identities", uc.GetIdentities)
+	if uc.oidc != nil {
+		account.POST("/users/:id/identities", uc.LinkIdentity)
+	}
+	account.DELETE("/users/:id/identities/:identityId", uc.DeleteIdentity)
+	account.GET("/users/:id/api-keys", uc.GetAPIKeys)
+	account.POST("/users/:id/api-keys", uc.PostAPIKey)
+	account.DELETE("/users/:id/api-keys/:keyId", uc.DeleteAPIKey)
 
 	// User methods
-	secure.GET("/users", uc.GetUsers) // TODO: size query param
-	secure.GET("/users/:id", uc.GetUserByID)
-	secure.DELETE("/users/:id", uc.DeleteUserByID)
+	usersRead := scoped(ScopeUsersRead)
+	usersRead.GET("/users", uc.GetUsers) // TODO: size query param
+	usersRead.GET("/users/:id", uc.GetUserByID)
 
 	// Favourites methods
-	secure.GET("/users/:id/favourites", uc.GetFavourites) // TODO: size query param
-	secure.POST("/users/:id/favourites", uc.PostFavourites)
-	secure.GET("/users/:id/favourites/:favId", uc.GetFavouriteByID)
-	secure.DELETE("/users/:id/favourites/:favId", uc.DeleteFavouriteByID)
+	favouritesRead, favouritesWrite := scoped(ScopeFavouritesRead), scoped(ScopeFavouritesWrite)
+	favouritesRead.GET("/users/:id/favourites", uc.GetFavourites) // TODO: size query param
+	favouritesWrite.POST("/users/:id/favourites", uc.PostFavourites)
+	favouritesRead.GET("/users/:id/favourites/:favId", uc.GetFavouriteByID)
+	favouritesWrite.DELETE("/users/:id/favourites/:favId", uc.DeleteFavouriteByID)
 
 	// Asset management
-	secure.GET("/assets", ac.GetAssets) // TODO: size query param
-	secure.POST("/assets", ac.PostAssets)
-	secure.GET("/assets/:id", ac.GetAssetByID)
-	secure.PUT("/assets/:id", ac.PutAssetByID)
-	secure.PATCH("/assets/:id", ac.PatchAssetByID)
-	secure.DELETE("/assets/:id", ac.DeleteAssetByID)
+	assetsRead, assetsWrite := scoped(ScopeAssetsRead), scoped(ScopeAssetsWrite)
+	assetsRead.GET("/assets", ac.GetAssets) // TODO: size query param
+	assetsWrite.POST("/assets", ac.PostAssets)
+	assetsRead.GET("/assets/:id", ac.GetAssetByID)
+	assetsWrite.PUT("/assets/:id", ac.PutAssetByID)
+	assetsWrite.PATCH("/assets/:id", ac.PatchAssetByID)
+	assetsWrite.DELETE("/assets/:id", ac.DeleteAssetByID)
+
+	// Administration of other users, which requires the admin role
+	admin := secure.Group("/admin", append([]gin.HandlerFunc{RequireScopes(ScopeAdmin), uc.RequireAdmin()}, validation...)...)
+	admin.GET("/users", uc.AdminGetUsers)
+	admin.GET("/users/:id", uc.AdminGetUserByID)
+	admin.POST("/users/:id/disable", uc.AdminDisableUser)
+	admin.POST("/users/:id/enable", uc.AdminEnableUser)
+	admin.POST("/users/:id/password-reset", uc.AdminForcePasswordReset)
+	admin.PUT("/users/:id/role", uc.AdminPutRole)
+	admin.POST("/users/:id/impersonate", uc.AdminImpersonate)
+	admin.POST("/users/:id/certificates", uc.AdminLinkClientCert)
+
+	// GraphQL queries, the resolvers check the scopes of each field
+	scoped().POST("/graphql", gc.PostGraphQL)
+
+	// Trash
+	assetsRead.GET("/trash/assets", ac.GetTrashedAssets)
+	assetsWrite.POST("/trash/assets/:id/restore", ac.RestoreAssetByID)
 	return engine
 }
@@ -0,0 +1,481 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	gqlotel "github.com/graph-gophers/graphql-go/trace/otel"
+	"gorm.io/gorm"
+)
+
+// graphQLSchema describes the queries of `POST /graphql`, resolved by
+// `graphQLResolver`. It is maintained by hand like `openAPIYAML`.
+//
+//go:embed schema.graphql
+var graphQLSchema string
+
+// graphQLMaxDepth limits the nesting of queries.
+const graphQLMaxDepth = 10
+
+// cursorPrefix is encoded with the id into the opaque cursors of pages.
+const cursorPrefix = "id:"
+
+// GraphQLController executes GraphQL queries over users, assets and favourites.
+type GraphQLController struct {
+	db            *gorm.DB
+	SessionConfig *gorm.Session
+	schema        *graphql.Schema
+}
+
+// NewGraphQLController parses `graphQLSchema` and checks it against the
+// resolvers.
+func NewGraphQLController(db *gorm.DB) (*GraphQLController, error) {
+	schema, err := graphql.ParseSchema(graphQLSchema, &graphQLResolver{},
+		graphql.MaxDepth(graphQLMaxDepth),
+		graphql.Tracer(gqlotel.DefaultTracer()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphQLController{db: db, SessionConfig: &gorm.Session{}, schema: schema}, nil
+}
+
+func (gc *GraphQLController) GetSession(c *gin.Context) *gorm.DB {
+	return gc.db.Session(gc.SessionConfig).WithContext(c.Request.Context())
+}
+
+// POST /graphql
+//
+// Errors of the query are part of the response with 200 status, like in any
+// GraphQL API. Authorization problems of fields keep their problem status in
+// the "extensions" of the errors.
+func (gc *GraphQLController) PostGraphQL(c *gin.Context) {
+	var query GraphQLQuery
+	if err := c.ShouldBindJSON(&query); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	request := newGraphQLRequest(c, gc.GetSession(c))
+	ctx := context.WithValue(c.Request.Context(), graphQLRequestKey{}, request)
+	response := gc.schema.Exec(ctx, query.Query, query.OperationName, query.Variables)
+	c.JSON(http.StatusOK, response)
+}
+
+// Extensions adds the status and type of problems returned by resolvers to
+// GraphQL errors.
+func (p *Problem) Extensions() map[string]interface{} {
+	return map[string]interface{}{"status": p.Status, "type": p.Type}
+}
+
+type graphQLRequestKey struct{}
+
+// graphQLRequest is the state shared by the resolvers of one query.
+type graphQLRequest struct {
+	c         *gin.Context
+	session   *gorm.DB
+	charts    *batchLoader[*db.Chart]
+	insights  *batchLoader[*db.Insight]
+	audiences *batchLoader[*db.Audience]
+}
+
+func newGraphQLRequest(c *gin.Context, session *gorm.DB) *graphQLRequest {
+	return &graphQLRequest{
+		c:        c,
+		session:  session,
+		charts:   newBatchLoader(byAssetID(session, func(chart *db.Chart) uint { return chart.AssetID })),
+		insights: newBatchLoader(byAssetID(session, func(insight *db.Insight) uint { return insight.AssetID })),
+		audiences: newBatchLoader(byAssetID(session.Preload("Characteristics"), func(audience *db.Audience) uint {
+			return audience.AssetID
+		})),
+	}
+}
+
+func graphQLRequestOf(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+// requireScope returns a 403 problem, like `RequireScopes`, unless the
+// credential was granted `scope`.
+func (r *graphQLRequest) requireScope(scope string) error {
+	if !containsScope(requestScopes(r.c), scope) {
+		return NewProblem(http.StatusForbidden, fmt.Sprintf("Missing required scope %q.", scope))
+	}
+	return nil
+}
+
+// graphQLResolver resolves the fields of the "Query" type.
+type graphQLResolver struct{}
+
+func (*graphQLResolver) Me(ctx context.Context) (*userResolver, error) {
+	r := graphQLRequestOf(ctx)
+	if err := r.requireScope(ScopeUsersRead); err != nil {
+		return nil, err
+	}
+	userId, _ := strconv.Atoi(r.c.GetString("jwt_sub"))
+	var dbUser db.User
+	if err := r.session.Where("id = ?", userId).First(&dbUser).Error; err != nil {
+		return nil, DBProblem(err)
+	}
+	return &userResolver{user: dbUser}, nil
+}
+
+func (*graphQLResolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	r := graphQLRequestOf(ctx)
+	if err := r.requireScope(ScopeUsersRead); err != nil {
+		return nil, err
+	}
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	var dbUsers []db.User
+	// Prevent ErrRecordNotFound, missing users are null
+	if err := r.session.Where("id = ?", id).Limit(1).Find(&dbUsers).Error; err != nil {
+		return nil, DBProblem(err)
+	}
+	if len(dbUsers) == 0 {
+		return nil, nil
+	}
+	return &userResolver{user: dbUsers[0]}, nil
+}
+
+func (*graphQLResolver) Users(ctx context.Context, args connectionArgs) (*userConnection, error) {
+	r := graphQLRequestOf(ctx)
+	if err := r.requireScope(ScopeUsersRead); err != nil {
+		return nil, err
+	}
+	dbUsers, hasNextPage, err := findPage[db.User](r.session, "id", args)
+	if err != nil {
+		return nil, err
+	}
+	connection := &userConnection{pageInfo: pageInfo{hasNextPage: hasNextPage}}
+	for _, dbUser := range dbUsers {
+		connection.edges = append(connection.edges, &userEdge{node: &userResolver{user: dbUser}})
+		connection.pageInfo.endCursor = dbUser.ID
+	}
+	return connection, nil
+}
+
+func (*graphQLResolver) Asset(ctx context.Context, args struct{ ID graphql.ID }) (*assetResolver, error) {
+	r := graphQLRequestOf(ctx)
+	if err := r.requireScope(ScopeAssetsRead); err != nil {
+		return nil, err
+	}
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	var dbAssets []db.Asset
+	if err := r.session.Where("id = ?", id).Limit(1).Find(&dbAssets).Error; err != nil {
+		return nil, DBProblem(err)
+	}
+	if len(dbAssets) == 0 {
+		return nil, nil
+	}
+	return &assetResolver{asset: dbAssets[0]}, nil
+}
+
+func (*graphQLResolver) Assets(ctx context.Context, args connectionArgs) (*assetConnection, error) {
+	r := graphQLRequestOf(ctx)
+	if err := r.requireScope(ScopeAssetsRead); err != nil {
+		return nil, err
+	}
+	dbAssets, hasNextPage, err := findPage[db.Asset](r.session, "id", args)
+	if err != nil {
+		return nil, err
+	}
+	return newAssetConnection(r, dbAssets, hasNextPage), nil
+}
+
+type userResolver struct {
+	user db.User
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return formatGraphQLID(u.user.ID)
+}
+
+func (u *userResolver) Username() string {
+	return u.user.Username
+}
+
+func (u *userResolver) DisplayName() *string {
+	return optionalString(u.user.DisplayName)
+}
+
+func (u *userResolver) AvatarURL() *string {
+	return optionalString(u.user.AvatarURL)
+}
+
+// Favourites are only readable for the user itself, like with
+// `GET /users/:id/favourites`.
+func (u *userResolver) Favourites(ctx context.Context, args connectionArgs) (*assetConnection, error) {
+	r := graphQLRequestOf(ctx)
+	if err := VerifyID(r.c, int(u.user.ID)); err != nil {
+		return nil, Forbidden()
+	}
+	if err := r.requireScope(ScopeFavouritesRead); err != nil {
+		return nil, err
+	}
+	query := r.session.Joins("JOIN user_assets ON user_assets.asset_id = assets.id AND user_assets.user_id = ?", u.user.ID)
+	dbAssets, hasNextPage, err := findPage[db.Asset](query, "assets.id", args)
+	if err != nil {
+		return nil, err
+	}
+	return newAssetConnection(r, dbAssets, hasNextPage), nil
+}
+
+type assetResolver struct {
+	asset db.Asset
+}
+
+func (a *assetResolver) ID() graphql.ID {
+	return formatGraphQLID(a.asset.ID)
+}
+
+func (a *assetResolver) Chart(ctx context.Context) (*chartResolver, error) {
+	chart, err := graphQLRequestOf(ctx).charts.load(ctx, a.asset.ID)
+	if err != nil || chart == nil {
+		return nil, err
+	}
+	return &chartResolver{chart: chart}, nil
+}
+
+func (a *assetResolver) Insight(ctx context.Context) (*insightResolver, error) {
+	insight, err := graphQLRequestOf(ctx).insights.load(ctx, a.asset.ID)
+	if err != nil || insight == nil {
+		return nil, err
+	}
+	return &insightResolver{insight: insight}, nil
+}
+
+func (a *assetResolver) Audience(ctx context.Context) (*audienceResolver, error) {
+	audience, err := graphQLRequestOf(ctx).audiences.load(ctx, a.asset.ID)
+	if err != nil || audience == nil {
+		return nil, err
+	}
+	return &audienceResolver{audience: audience}, nil
+}
+
+type chartResolver struct {
+	chart *db.Chart
+}
+
+func (c *chartResolver) Title() string {
+	return c.chart.Title
+}
+
+func (c *chartResolver) TitleX() string {
+	return c.chart.TitleX
+}
+
+func (c *chartResolver) TitleY() string {
+	return c.chart.TitleY
+}
+
+// Data is the base64 encoded string of the REST API, as it is stored.
+func (c *chartResolver) Data() *string {
+	switch data := c.chart.Data.(type) {
+	case string:
+		return &data
+	case []byte:
+		encoded := base64.StdEncoding.EncodeToString(data)
+		return &encoded
+	}
+	return nil
+}
+
+type insightResolver struct {
+	insight *db.Insight
+}
+
+func (i *insightResolver) Description() string {
+	return i.insight.Description
+}
+
+type audienceResolver struct {
+	audience *db.Audience
+}
+
+func (a *audienceResolver) Characteristics() []*characteristicResolver {
+	characteristics := make([]*characteristicResolver, len(a.audience.Characteristics))
+	for i, characteristic := range a.audience.Characteristics {
+		characteristics[i] = &characteristicResolver{characteristic: characteristic}
+	}
+	return characteristics
+}
+
+type characteristicResolver struct {
+	characteristic *db.Characteristic
+}
+
+func (c *characteristicResolver) Gender() string {
+	return c.characteristic.Gender
+}
+
+func (c *characteristicResolver) BirthCountry() string {
+	return c.characteristic.BirthCountry
+}
+
+func (c *characteristicResolver) AgeGroup() string {
+	return c.characteristic.AgeGroupRange
+}
+
+func (c *characteristicResolver) SocialMediaHours() string {
+	return c.characteristic.SocMediaHours
+}
+
+// connectionArgs are the arguments of paginated fields.
+type connectionArgs struct {
+	First int32
+	After *string
+}
+
+// findPage finds the page of `args` with `query`, in the order of the id
+// `column`, and whether there are more items after it.
+func findPage[T any](query *gorm.DB, column string, args connectionArgs) ([]T, bool, error) {
+	if args.First < 1 || args.First > MaxPageSize {
+		return nil, false, NewProblem(http.StatusBadRequest, "First must be between 1 and "+strconv.Itoa(MaxPageSize)+".")
+	}
+	if args.After != nil {
+		after, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where(column+" > ?", after)
+	}
+	var items []T
+	if err := query.Order(column).Limit(int(args.First) + 1).Find(&items).Error; err != nil {
+		return nil, false, DBProblem(err)
+	}
+	if len(items) > int(args.First) {
+		return items[:args.First], true, nil
+	}
+	return items, false, nil
+}
+
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeCursor(cursor string) (uint, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(decoded), cursorPrefix) {
+		id, err := strconv.ParseUint(strings.TrimPrefix(string(decoded), cursorPrefix), 10, 0)
+		if err == nil {
+			return uint(id), nil
+		}
+	}
+	return 0, NewProblem(http.StatusBadRequest, fmt.Sprintf("Invalid cursor %q.", cursor))
+}
+
+type pageInfo struct {
+	hasNextPage bool
+	// endCursor is the id of the last item, 0 for empty pages
+	endCursor uint
+}
+
+func (p pageInfo) HasNextPage() bool {
+	return p.hasNextPage
+}
+
+func (p pageInfo) EndCursor() *string {
+	if p.endCursor == 0 {
+		return nil
+	}
+	cursor := encodeCursor(p.endCursor)
+	return &cursor
+}
+
+type userConnection struct {
+	edges    []*userEdge
+	pageInfo pageInfo
+}
+
+func (c *userConnection) Edges() []*userEdge {
+	return c.edges
+}
+
+func (c *userConnection) PageInfo() pageInfo {
+	return c.pageInfo
+}
+
+type userEdge struct {
+	node *userResolver
+}
+
+func (e *userEdge) Cursor() string {
+	return encodeCursor(e.node.user.ID)
+}
+
+func (e *userEdge) Node() *userResolver {
+	return e.node
+}
+
+type assetConnection struct {
+	edges    []*assetEdge
+	pageInfo pageInfo
+}
+
+// newAssetConnection queues the parts of `dbAssets` in the loaders of `r`, so
+// that they are loaded with one query per part for the whole page.
+func newAssetConnection(r *graphQLRequest, dbAssets []db.Asset, hasNextPage bool) *assetConnection {
+	connection := &assetConnection{pageInfo: pageInfo{hasNextPage: hasNextPage}}
+	ids := make([]uint, len(dbAssets))
+	for i, dbAsset := range dbAssets {
+		ids[i] = dbAsset.ID
+		connection.edges = append(connection.edges, &assetEdge{node: &assetResolver{asset: dbAsset}})
+		connection.pageInfo.endCursor = dbAsset.ID
+	}
+	r.charts.prime(ids...)
+	r.insights.prime(ids...)
+	r.audiences.prime(ids...)
+	return connection
+}
+
+func (c *assetConnection) Edges() []*assetEdge {
+	return c.edges
+}
+
+func (c *assetConnection) PageInfo() pageInfo {
+	return c.pageInfo
+}
+
+type assetEdge struct {
+	node *assetResolver
+}
+
+func (e *assetEdge) Cursor() string {
+	return encodeCursor(e.node.asset.ID)
+}
+
+func (e *assetEdge) Node() *assetResolver {
+	return e.node
+}
+
+func formatGraphQLID(id uint) graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(id), 10))
+}
+
+func parseGraphQLID(id graphql.ID) (uint, error) {
+	parsed, err := strconv.ParseUint(string(id), 10, 0)
+	if err != nil {
+		return 0, NewProblem(http.StatusBadRequest, fmt.Sprintf("Invalid id %q.", id))
+	}
+	return uint(parsed), nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
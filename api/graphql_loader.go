@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// batchLoader loads values by id for the resolvers of one GraphQL query.
+// The ids of a list are queued with `prime` when the list is resolved, and the
+// first `load` fetches all queued ids at once, so that the fields of the items
+// need one query for the whole list instead of one query per item.
+type batchLoader[V any] struct {
+	fetch func(ctx context.Context, ids []uint) (map[uint]V, error)
+
+	mu     sync.Mutex
+	queued []uint
+	// values holds the zero value for ids without value, so that they are
+	// not fetched again
+	values map[uint]V
+}
+
+func newBatchLoader[V any](fetch func(ctx context.Context, ids []uint) (map[uint]V, error)) *batchLoader[V] {
+	return &batchLoader[V]{fetch: fetch, values: make(map[uint]V)}
+}
+
+// prime queues `ids` for the next fetch.
+func (l *batchLoader[V]) prime(ids ...uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		if _, loaded := l.values[id]; !loaded {
+			l.queued = append(l.queued, id)
+		}
+	}
+}
+
+// load returns the value of `id`, fetching it together with the queued ids
+// unless it was fetched before.
+func (l *batchLoader[V]) load(ctx context.Context, id uint) (V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if value, loaded := l.values[id]; loaded {
+		return value, nil
+	}
+	ids := append(l.queued, id)
+	l.queued = nil
+	values, err := l.fetch(ctx, ids)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	for _, id := range ids {
+		l.values[id] = values[id]
+	}
+	return values[id], nil
+}
+
+// byAssetID returns the fetch function of a loader of the charts, insights or
+// audiences of assets, found by their "asset_id" with `session`.
+func byAssetID[T any](session *gorm.DB, assetID func(*T) uint) func(context.Context, []uint) (map[uint]*T, error) {
+	return func(ctx context.Context, ids []uint) (map[uint]*T, error) {
+		var items []*T
+		if err := session.WithContext(ctx).Where("asset_id IN ?", ids).Find(&items).Error; err != nil {
+			return nil, DBProblem(err)
+		}
+		values := make(map[uint]*T, len(items))
+		for _, item := range items {
+			values[assetID(item)] = item
+		}
+		return values, nil
+	}
+}
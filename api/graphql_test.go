@@ -0,0 +1,202 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/gorm"
+)
+
+// performGraphQL returns the decoded response of `query`, which must have
+// 200 status.
+func performGraphQL(t *testing.T, router *gin.Engine, token, query string, variables gin.H) gin.H {
+	t.Helper()
+	w := performAuthRequest(router, "POST", "/api/v1/graphql", token, jsonBody(t, gin.H{
+		"query":     query,
+		"variables": variables,
+	}))
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	return decodeBody(t, w.Body.Bytes())
+}
+
+// graphQLError returns the message and status of the only error of `got`.
+func graphQLError(t *testing.T, got gin.H) (string, float64) {
+	t.Helper()
+	errors, _ := got["errors"].([]interface{})
+	if len(errors) != 1 {
+		t.Fatalf("expected one error: %v", got)
+	}
+	err := errors[0].(map[string]interface{})
+	extensions, _ := err["extensions"].(map[string]interface{})
+	status, _ := extensions["status"].(float64)
+	return err["message"].(string), status
+}
+
+func requestToken(t *testing.T, router *gin.Engine, username string, scopes ...string) string {
+	t.Helper()
+	credentials := gin.H{"username": username, "password": "testpass1"}
+	if len(scopes) > 0 {
+		credentials["scopes"] = scopes
+	}
+	w := performRequest(router, "POST", "/api/v1/token", jsonBody(t, credentials))
+	assert.Equal(t, 200, w.Code)
+	return decodeBody(t, w.Body.Bytes())["token"].(string)
+}
+
+func TestGraphQL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token := requestToken(t, router, "test")
+	w := performAuthRequest(router, "POST", "/api/v1/users/1/favourites", token, jsonBody(t, gin.H{"id": 3}))
+	assert.Equal(t, 201, w.Code)
+
+	got := performGraphQL(t, router, token, `{
+		me {
+			id
+			username
+			favourites {
+				edges { node { id audience { characteristics { gender birthCountry } } } }
+			}
+		}
+	}`, nil)
+	assert.Equal(t, nil, got["errors"])
+	assert.Equal(t, gin.H{"me": map[string]interface{}{
+		"id":       "1",
+		"username": "test",
+		"favourites": map[string]interface{}{"edges": []interface{}{
+			map[string]interface{}{"node": map[string]interface{}{
+				"id": "3",
+				"audience": map[string]interface{}{"characteristics": []interface{}{
+					map[string]interface{}{"gender": "M", "birthCountry": "Czech Republic"},
+				}},
+			}},
+		}},
+	}}, gin.H(got["data"].(map[string]interface{})))
+
+	got = performGraphQL(t, router, token, `query($id: ID!) { asset(id: $id) { insight { description } chart { title } } }`, gin.H{"id": "2"})
+	assert.Equal(t, map[string]interface{}{"asset": map[string]interface{}{
+		"insight": map[string]interface{}{"description": "Test insight"},
+		"chart":   nil,
+	}}, got["data"])
+	got = performGraphQL(t, router, token, `{ asset(id: "42") { id } }`, nil)
+	assert.Equal(t, map[string]interface{}{"asset": nil}, got["data"])
+	assert.Equal(t, nil, got["errors"])
+
+	// Favourites of other users are forbidden like in the REST API
+	w = performRequest(router, "POST", "/api/v1/users", jsonBody(t, gin.H{"username": "other", "password": "testpass1"}))
+	assert.Equal(t, 201, w.Code)
+	got = performGraphQL(t, router, token, `{ user(id: "2") { username favourites { edges { cursor } } } }`, nil)
+	message, status := graphQLError(t, got)
+	assert.Equal(t, float64(403), status)
+	assert.Equal(t, true, strings.Contains(message, "You do not have access"))
+	assert.Equal(t, nil, got["data"].(map[string]interface{})["user"])
+
+	// Queries are required, invalid queries are GraphQL errors
+	w = performAuthRequest(router, "POST", "/api/v1/graphql", token, jsonBody(t, gin.H{}))
+	assert.Equal(t, 400, w.Code)
+	got = performGraphQL(t, router, token, `{ assets { edges { node { secret } } } }`, nil)
+	message, _ = graphQLError(t, got)
+	assert.Equal(t, true, strings.Contains(message, `Cannot query field "secret"`))
+}
+
+func TestGraphQLScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token := requestToken(t, router, "test", ScopeAssetsRead)
+
+	got := performGraphQL(t, router, token, `{ assets { edges { node { id } } } }`, nil)
+	assert.Equal(t, nil, got["errors"])
+	got = performGraphQL(t, router, token, `{ me { id } }`, nil)
+	message, status := graphQLError(t, got)
+	assert.Equal(t, float64(403), status)
+	assert.Equal(t, true, strings.Contains(message, ScopeUsersRead))
+
+	// Without a credential the endpoint is not reachable at all
+	w := performRequest(router, "POST", "/api/v1/graphql", jsonBody(t, gin.H{"query": "{ assets { edges { cursor } } }"}))
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestGraphQLPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token := requestToken(t, router, "test")
+
+	const query = `query($after: String) {
+		assets(first: 2, after: $after) {
+			edges { node { id } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+	var ids []interface{}
+	var after interface{}
+	for pages := 0; ; pages++ {
+		got := performGraphQL(t, router, token, query, gin.H{"after": after})
+		assert.Equal(t, nil, got["errors"])
+		assets := got["data"].(map[string]interface{})["assets"].(map[string]interface{})
+		for _, edge := range assets["edges"].([]interface{}) {
+			ids = append(ids, edge.(map[string]interface{})["node"].(map[string]interface{})["id"])
+		}
+		pageInfo := assets["pageInfo"].(map[string]interface{})
+		if pageInfo["hasNextPage"] == false {
+			assert.Equal(t, 1, pages)
+			break
+		}
+		after = pageInfo["endCursor"]
+	}
+	assert.Equal(t, []interface{}{"1", "2", "3"}, ids)
+
+	got := performGraphQL(t, router, token, query, gin.H{"after": "nonsense"})
+	_, status := graphQLError(t, got)
+	assert.Equal(t, float64(400), status)
+	got = performGraphQL(t, router, token, `{ assets(first: 1000) { edges { cursor } } }`, nil)
+	_, status = graphQLError(t, got)
+	assert.Equal(t, float64(400), status)
+}
+
+func TestGraphQLBatching(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token := requestToken(t, router, "test")
+
+	var queries int
+	err := database.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) {
+		queries++
+	})
+	assert.Equal(t, nil, err)
+	countQueries := func(first int) int {
+		queries = 0
+		got := performGraphQL(t, router, token, `query($first: Int) {
+			assets(first: $first) {
+				edges { node { id chart { title } insight { description } audience { characteristics { gender } } } }
+			}
+		}`, gin.H{"first": first})
+		assert.Equal(t, nil, got["errors"])
+		return queries
+	}
+
+	// The first request of the token loads the revocations
+	countQueries(3)
+	few := countQueries(3)
+	for i := 0; i < 10; i++ {
+		w := performAuthRequest(router, "POST", "/api/v1/assets", token, jsonBody(t, gin.H{
+			"insight":  gin.H{"description": "insight"},
+			"audience": gin.H{"characteristics": []gin.H{{"gender": "F", "birth_country": "Greece"}}},
+		}))
+		assert.Equal(t, 201, w.Code)
+	}
+	// The parts of all assets of the page are loaded together
+	assert.Equal(t, few, countQueries(13))
+}
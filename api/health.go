@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Version of the build, set with
+// -ldflags "-X github.com/GlobalWebIndex/platform2.0-go-challenge/api.Version=1.2.3".
+var Version = "dev"
+
+// HealthCheckTimeout limits how long readiness waits for the database.
+var HealthCheckTimeout = 2 * time.Second
+
+var startedAt = time.Now()
+
+// HealthController answers the probes of the orchestrator.
+type HealthController struct {
+	db *gorm.DB
+	// migrated is set once the schema was found complete, which cannot change
+	migrated int32
+}
+
+// GET /healthz
+// Healthz reports that the process is alive, without checking dependencies.
+func (hc *HealthController) Healthz(c *gin.Context) {
+	c.PureJSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// GET /readyz
+// Readyz reports whether requests can be served, that is the database is
+// reachable and migrated.
+func (hc *HealthController) Readyz(c *gin.Context) {
+	if err := hc.checkDB(c.Request.Context()); err != nil {
+		RequestLogger(c).Warn("database check failed", "error", err.Error())
+		abortWithProblem(c, NewProblem(http.StatusServiceUnavailable, "Not ready: the database is unavailable."))
+		return
+	}
+	c.PureJSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// GET /status
+// Status describes the build, uptime and database connections.
+// Database errors are only logged, as the endpoint is public.
+func (hc *HealthController) Status(c *gin.Context) {
+	status := "ok"
+	database := gin.H{"status": "ok"}
+	if err := hc.checkDB(c.Request.Context()); err != nil {
+		RequestLogger(c).Warn("database check failed", "error", err.Error())
+		status = "degraded"
+		database["status"] = "unavailable"
+	}
+	if sqlDB, err := hc.db.DB(); err == nil {
+		stats := sqlDB.Stats()
+		database["max_open_connections"] = stats.MaxOpenConnections
+		database["open_connections"] = stats.OpenConnections
+		database["in_use"] = stats.InUse
+		database["idle"] = stats.Idle
+		database["wait_count"] = stats.WaitCount
+		database["wait_duration_seconds"] = stats.WaitDuration.Seconds()
+	}
+	c.PureJSON(http.StatusOK, gin.H{
+		"status":         status,
+		"version":        Version,
+		"go_version":     runtime.Version(),
+		"started_at":     startedAt.UTC().Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		"database":       database,
+	})
+}
+
+// checkDB pings the database and checks that it is migrated.
+func (hc *HealthController) checkDB(ctx context.Context) error {
+	sqlDB, err := hc.db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	if atomic.LoadInt32(&hc.migrated) == 1 {
+		return nil
+	}
+	if err := db.CheckMigrated(hc.db.WithContext(ctx)); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&hc.migrated, 1)
+	return nil
+}
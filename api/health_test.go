@@ -0,0 +1,65 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	router := CreateTestEngine(database, true)
+
+	w := performRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "GET", "/readyz", nil)
+	assert.Equal(t, 200, w.Code)
+
+	w = performRequest(router, "GET", "/status", nil)
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "ok", got["status"])
+	assert.Equal(t, Version, got["version"])
+	assert.Equal(t, "ok", got["database"].(map[string]interface{})["status"])
+}
+
+func TestReadyzUnmigrated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.Equal(t, nil, err)
+	router := CreateTestEngine(database, true)
+	logs := captureLogs(t)
+
+	// Alive, but cannot serve requests yet
+	w := performRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "GET", "/readyz", nil)
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, false, strings.Contains(w.Body.String(), "table"))
+	w = performRequest(router, "GET", "/status", nil)
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "degraded", got["status"])
+	// The cause is logged, but not shown to anonymous callers
+	dbStatus := got["database"].(map[string]interface{})
+	assert.Equal(t, "unavailable", dbStatus["status"])
+	_, hasError := dbStatus["error"]
+	assert.Equal(t, false, hasError)
+	assert.Equal(t, true, strings.Contains(logs.String(), "database check failed"))
+
+	db.Migrate(database)
+	w = performRequest(router, "GET", "/readyz", nil)
+	assert.Equal(t, 200, w.Code)
+
+	// Closed connections are not ready
+	sqlDB, _ := database.DB()
+	sqlDB.Close()
+	w = performRequest(router, "GET", "/readyz", nil)
+	assert.Equal(t, 503, w.Code)
+}
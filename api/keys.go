@@ -0,0 +1,285 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is a key used to sign or verify tokens.
+// For HS256 both `Private` and `Public` hold the shared secret, for
+// asymmetric algorithms `Private` is nil for verification-only keys.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// NewSigningKey parses a key for algorithm `alg` identified by `id`.
+// `material` is the secret for HS256, or a PEM encoded private key
+// (or public key for verification-only keys) for other algorithms.
+func NewSigningKey(id, alg string, material []byte) (*SigningKey, error) {
+	if id == "" {
+		return nil, errors.New("key id should not be empty")
+	}
+	key := &SigningKey{ID: id}
+	var err error
+	switch alg {
+	case AlgHS256:
+		if len(material) < 32 {
+			return nil, errors.New("HS256 secret should be at least 32 bytes long")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.Private, key.Public = material, material
+	case AlgRS256:
+		key.Method = jwt.SigningMethodRS256
+		if key.Private, err = jwt.ParseRSAPrivateKeyFromPEM(material); err == nil {
+			key.Public = &key.Private.(*rsa.PrivateKey).PublicKey
+		} else {
+			key.Private = nil
+			key.Public, err = jwt.ParseRSAPublicKeyFromPEM(material)
+		}
+	case AlgES256:
+		key.Method = jwt.SigningMethodES256
+		if key.Private, err = jwt.ParseECPrivateKeyFromPEM(material); err == nil {
+			key.Public = &key.Private.(*ecdsa.PrivateKey).PublicKey
+		} else {
+			key.Private = nil
+			key.Public, err = jwt.ParseECPublicKeyFromPEM(material)
+		}
+	case AlgEdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+		if key.Private, err = jwt.ParseEdPrivateKeyFromPEM(material); err == nil {
+			key.Public = key.Private.(ed25519.PrivateKey).Public()
+		} else {
+			key.Private = nil
+			key.Public, err = jwt.ParseEdPublicKeyFromPEM(material)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+	return key, nil
+}
+
+// KeySet holds the active signing key and all keys accepted for verification.
+// Keeping the previous keys for verification allows rotating the signing key
+// without invalidating tokens that were already issued.
+type KeySet struct {
+	mu      sync.RWMutex
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// NewKeySet creates a key set signing with `signing` and verifying with
+// `signing` and `verification` keys.
+func NewKeySet(signing *SigningKey, verification ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{}
+	if err := ks.Rotate(signing, verification...); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Rotate replaces the keys of the set, see `NewKeySet`.
+func (ks *KeySet) Rotate(signing *SigningKey, verification ...*SigningKey) error {
+	if signing == nil || signing.Private == nil {
+		return errors.New("signing key requires a private key")
+	}
+	keys := map[string]*SigningKey{signing.ID: signing}
+	for _, key := range verification {
+		if _, ok := keys[key.ID]; ok {
+			return fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		keys[key.ID] = key
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.signing = signing
+	ks.keys = keys
+	return nil
+}
+
+// Sign signs `claims` with the active key and sets the "kid" header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	signing := ks.signing
+	ks.mu.RUnlock()
+	token := jwt.NewWithClaims(signing.Method, claims)
+	token.Header["kid"] = signing.ID
+	return token.SignedString(signing.Private)
+}
+
+// Keyfunc looks up the verification key of `token` by its "kid" header.
+// Tokens without "kid" are verified with the active signing key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key := ks.signing
+	if kid, ok := token.Header["kid"]; ok {
+		id, _ := kid.(string)
+		if key, ok = ks.keys[id]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", id)
+		}
+	}
+	// Prevents algorithm confusion, e.g. verifying HS256 with a public RSA key
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWK is a public key in the JSON Web Key format, see RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at "/.well-known/jwks.json".
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys of the set.
+// Shared HS256 secrets are never published.
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64URL(public.N.Bytes())
+			jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = public.Curve.Params().Name
+			jwk.X = base64URL(public.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64URL(public.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64URL(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// PublicKey decodes the key, e.g. of a JWKS fetched from an identity provider.
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwtKeys signs and verifies all tokens issued by the api.
+// Until `SetKeySet` is called, a random HS256 secret is used, so tokens do
+// not survive a restart.
+var jwtKeys = randomKeySet()
+
+func randomKeySet() *KeySet {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	key, _ := NewSigningKey("default", AlgHS256, secret)
+	ks, _ := NewKeySet(key)
+	return ks
+}
+
+// SetKeySet replaces the keys used to sign and verify tokens.
+func SetKeySet(ks *KeySet) {
+	jwtKeys = ks
+}
+
+// GET /.well-known/jwks.json
+// GetJWKS publishes the public keys so that other services can verify our tokens.
+func GetJWKS(c *gin.Context) {
+	c.PureJSON(http.StatusOK, jwtKeys.JWKS())
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func privatePEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func testClaims() *jwt.StandardClaims {
+	return &jwt.StandardClaims{Subject: "1", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+}
+
+func TestSigningAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	materials := map[string][]byte{
+		AlgHS256: []byte("0123456789abcdef0123456789abcdef"),
+		AlgRS256: privatePEM(t, rsaKey),
+		AlgES256: privatePEM(t, ecKey),
+		AlgEdDSA: privatePEM(t, edKey),
+	}
+	for alg, material := range materials {
+		key, err := NewSigningKey("key-"+alg, alg, material)
+		if err != nil {
+			t.Fatalf("NewSigningKey(%s): %v", alg, err)
+		}
+		ks, err := NewKeySet(key)
+		assert.Equal(t, err, nil)
+
+		signed, err := ks.Sign(testClaims())
+		assert.Equal(t, err, nil)
+		token, err := jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, ks.Keyfunc)
+		if err != nil {
+			t.Fatalf("verify %s: %v", alg, err)
+		}
+		assert.Equal(t, alg, token.Method.Alg())
+		assert.Equal(t, "key-"+alg, token.Header["kid"])
+	}
+
+	_, err := NewSigningKey("short", AlgHS256, []byte("secret"))
+	assert.NotEqual(t, err, nil)
+	_, err = NewSigningKey("none", "none", nil)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newEC, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	oldKey, err := NewSigningKey("2022-01", AlgRS256, privatePEM(t, oldRSA))
+	assert.Equal(t, err, nil)
+	newKey, err := NewSigningKey("2022-06", AlgES256, privatePEM(t, newEC))
+	assert.Equal(t, err, nil)
+
+	ks, err := NewKeySet(oldKey)
+	assert.Equal(t, err, nil)
+	oldToken, err := ks.Sign(testClaims())
+	assert.Equal(t, err, nil)
+
+	// The old key only verifies after the rotation
+	oldPublic, err := NewSigningKey("2022-01", AlgRS256, publicPEM(t, &oldRSA.PublicKey))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ks.Rotate(newKey, oldPublic), nil)
+	newToken, err := ks.Sign(testClaims())
+	assert.Equal(t, err, nil)
+	for _, signed := range []string{oldToken, newToken} {
+		_, err = jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, ks.Keyfunc)
+		assert.Equal(t, err, nil)
+	}
+
+	// Verification-only keys cannot sign
+	assert.NotEqual(t, ks.Rotate(oldPublic), nil)
+
+	// Tokens signed with an unknown key id are refused
+	other, err := NewKeySet(newKey)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ks.Rotate(oldKey), nil)
+	_, err = jwt.ParseWithClaims(newToken, &jwt.StandardClaims{}, ks.Keyfunc)
+	assert.NotEqual(t, err, nil)
+	_, err = jwt.ParseWithClaims(newToken, &jwt.StandardClaims{}, other.Keyfunc)
+	assert.Equal(t, err, nil)
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key, err := NewSigningKey("rsa", AlgRS256, privatePEM(t, rsaKey))
+	assert.Equal(t, err, nil)
+	ks, err := NewKeySet(key)
+	assert.Equal(t, err, nil)
+
+	// HS256 token keyed with the public key material must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "rsa"
+	signed, err := forged.SignedString(publicPEM(t, &rsaKey.PublicKey))
+	assert.Equal(t, err, nil)
+	_, err = jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, ks.Keyfunc)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestGetJWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := jwtKeys
+	defer SetKeySet(previous)
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	signing, err := NewSigningKey("ed", AlgEdDSA, privatePEM(t, edKey))
+	assert.Equal(t, err, nil)
+	secret, err := NewSigningKey("hmac", AlgHS256, []byte("0123456789abcdef0123456789abcdef"))
+	assert.Equal(t, err, nil)
+	ks, err := NewKeySet(signing, secret)
+	assert.Equal(t, err, nil)
+	SetKeySet(ks)
+
+	router := CreateTestEngine(initDB(), true)
+	w := performRequest(router, "GET", "/.well-known/jwks.json", nil)
+	assert.Equal(t, 200, w.Code)
+
+	var got JWKSet
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The HS256 secret is not published
+	assert.Equal(t, 1, len(got.Keys))
+	assert.Equal(t, JWK{
+		KeyType:   "OKP",
+		KeyID:     "ed",
+		Use:       "sig",
+		Algorithm: AlgEdDSA,
+		Curve:     "Ed25519",
+		X:         base64URL(edKey.Public().(ed25519.PublicKey)),
+	}, got.Keys[0])
+
+	// Tokens issued by the api use the configured key
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	_, err = ParseToken(token)
+	assert.Equal(t, err, nil)
+}
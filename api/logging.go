@@ -0,0 +1,107 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultLogger receives the access log and errors of the engine.
+var DefaultLogger = slog.Default()
+
+// RequestIDHeader carries the id correlating logs of a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of the request id
+const requestIDKey = "request_id"
+
+// validRequestID limits ids from clients to safe characters, so that they
+// cannot forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware keeps the "X-Request-ID" of the request, or generates
+// one, and returns it in the response header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestId) {
+			requestId = newRequestID()
+		}
+		c.Set(requestIDKey, requestId)
+		c.Header(RequestIDHeader, requestId)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// RequestLogger returns `DefaultLogger` with the request and trace ids of `c`.
+func RequestLogger(c *gin.Context) *slog.Logger {
+	args := []any{slog.String(requestIDKey, c.GetString(requestIDKey))}
+	for _, attr := range traceAttrs(c.Request.Context()) {
+		args = append(args, attr)
+	}
+	return DefaultLogger.With(args...)
+}
+
+// LoggerMiddleware logs every request once it is handled. Server errors are
+// logged as errors and client errors as warnings.
+func LoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String(requestIDKey, c.GetString(requestIDKey)),
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		attrs = append(attrs, traceAttrs(c.Request.Context())...)
+		if userId := c.GetString("jwt_sub"); userId != "" {
+			attrs = append(attrs, slog.String("user_id", userId))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.Last().Error()))
+		}
+		DefaultLogger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// RecoveryMiddleware logs panics of handlers and responds with a problem
+// instead of dropping the connection.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err interface{}) {
+		RequestLogger(c).Error("panic while handling request", "panic", err, "path", c.Request.URL.Path)
+		// The handlers after this one, including `ErrorHandler`, were unwound
+		respondWithProblem(c, *NewProblem(http.StatusInternalServerError, ""))
+	})
+}
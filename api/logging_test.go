@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+// captureLogs sends `DefaultLogger` into the returned buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	previous := DefaultLogger
+	DefaultLogger = slog.New(slog.NewJSONHandler(&buffer, nil))
+	t.Cleanup(func() { DefaultLogger = previous })
+	return &buffer
+}
+
+func performRequestWithID(r http.Handler, path, token, requestId string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(RequestIDHeader, requestId)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeLogLines(t *testing.T, buffer *bytes.Buffer) []gin.H {
+	var lines []gin.H
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var entry gin.H
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestRequestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	logs := captureLogs(t)
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	w := performRequestWithID(router, "/api/v1/users/1", token, "abc-123")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+
+	entry := decodeLogLines(t, logs)[0]
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "abc-123", entry["request_id"])
+	assert.Equal(t, "/api/v1/users/:id", entry["route"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, "1", entry["user_id"])
+	_, hasLatency := entry["latency_ms"]
+	assert.Equal(t, true, hasLatency)
+
+	// Ids that could forge log lines are replaced
+	logs.Reset()
+	w = performRequestWithID(router, "/api/v1/users/1", "invalid", `abc"}{"level":"ERROR`)
+	assert.Equal(t, 401, w.Code)
+	requestId := w.Header().Get(RequestIDHeader)
+	assert.Equal(t, 32, len(requestId))
+	entry = decodeLogLines(t, logs)[0]
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, requestId, entry["request_id"])
+	_, hasUser := entry["user_id"]
+	assert.Equal(t, false, hasUser)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := CreateTestEngine(initDB(), true)
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+	logs := captureLogs(t)
+
+	w := performRequest(router, "GET", "/panic", nil)
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	lines := decodeLogLines(t, logs)
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, "boom", lines[0]["panic"])
+	assert.Equal(t, "ERROR", lines[1]["level"])
+	assert.Equal(t, float64(500), lines[1]["status"])
+}
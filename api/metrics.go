@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// metricsRegistry holds the metrics served by `Metrics`, together with the
+// metrics of the Go runtime and the process.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	registerMetrics = promauto.With(metricsRegistry)
+
+	httpRequests = registerMetrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = registerMetrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method, route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	dbQueryDuration = registerMetrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Latency of database statements by operation and table.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+	dbQueryErrors = registerMetrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Failed database statements by operation and table.",
+	}, []string{"operation", "table"})
+	usersGauge = registerMetrics.NewGauge(prometheus.GaugeOpts{
+		Name: "app_users",
+		Help: "Users that are not in the trash.",
+	})
+	assetsGauge = registerMetrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "app_assets",
+		Help: "Assets that are not in the trash by type.",
+	}, []string{"type"})
+	favouritesGauge = registerMetrics.NewGauge(prometheus.GaugeOpts{
+		Name: "app_favourites",
+		Help: "Assets marked as favourite by users.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MetricsMiddleware counts requests and their latency by route template, so
+// that paths with ids do not create a series each.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(c.Request.Method)
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// methodLabel returns `method` if it is a standard method, or "other", so
+// that clients cannot create series with made up methods.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// DBMetrics is a gorm plugin measuring the latency and errors of statements.
+type DBMetrics struct{}
+
+func (DBMetrics) Name() string {
+	return "metrics"
+}
+
+const dbMetricsStartKey = "metrics:start"
+
+// Initialize registers callbacks around every operation of gorm.
+func (DBMetrics) Initialize(database *gorm.DB) error {
+	return registerAround(database, "metrics", func(operation string, tx *gorm.DB) {
+		tx.InstanceSet(dbMetricsStartKey, time.Now())
+	}, func(operation string, tx *gorm.DB) {
+		value, ok := tx.InstanceGet(dbMetricsStartKey)
+		if !ok {
+			return
+		}
+		table := tx.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		dbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(value.(time.Time)).Seconds())
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			dbQueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	})
+}
+
+// registerAround registers `before` and `after` as callbacks named after
+// `plugin` around every operation of gorm, e.g. "create" or "query".
+func registerAround(database *gorm.DB, plugin string, before, after func(operation string, tx *gorm.DB)) error {
+	callbacks := database.Callback()
+	type register func(name string, fn func(*gorm.DB)) error
+	for _, op := range []struct {
+		name          string
+		before, after register
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	} {
+		operation := op.name
+		err := op.before(plugin+":before_"+operation, func(tx *gorm.DB) { before(operation, tx) })
+		if err != nil {
+			return err
+		}
+		err = op.after(plugin+":after_"+operation, func(tx *gorm.DB) { after(operation, tx) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GET /metrics
+// Metrics serves the metrics in the Prometheus text format. The domain
+// gauges are counted from `database` on every scrape.
+func Metrics(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := updateDomainGauges(database.WithContext(c.Request.Context())); err != nil {
+			abortWithProblem(c, DBProblem(err))
+			return
+		}
+		metricsHandler.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+func updateDomainGauges(database *gorm.DB) error {
+	var users int64
+	if result := database.Model(&db.User{}).Count(&users); result.Error != nil {
+		return result.Error
+	}
+	usersGauge.Set(float64(users))
+
+	for assetType, model := range map[string]interface{}{
+		"chart":    &db.Chart{},
+		"insight":  &db.Insight{},
+		"audience": &db.Audience{},
+	} {
+		var count int64
+		result := database.Model(model).
+			Joins("JOIN assets ON assets.id = asset_id AND assets.deleted_at IS NULL").
+			Count(&count)
+		if result.Error != nil {
+			return result.Error
+		}
+		assetsGauge.WithLabelValues(assetType).Set(float64(count))
+	}
+
+	var favourites int64
+	result := database.Table("user_assets").
+		Joins("JOIN users ON users.id = user_assets.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN assets ON assets.id = user_assets.asset_id AND assets.deleted_at IS NULL").
+		Count(&favourites)
+	if result.Error != nil {
+		return result.Error
+	}
+	favouritesGauge.Set(float64(favourites))
+	return nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	w := performAuthRequest(router, "POST", "/api/v1/users/1/favourites", token, jsonBody(t, gin.H{"id": 2}))
+	assert.Equal(t, 201, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "GET", "/nowhere", nil)
+	assert.Equal(t, 404, w.Code)
+	w = performRequest(router, "BREW", "/nowhere", nil)
+	assert.Equal(t, 404, w.Code)
+
+	w = performRequest(router, "GET", "/metrics", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, true, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	body := w.Body.String()
+	for _, line := range []string{
+		// Ids are not part of the route
+		`http_requests_total{method="GET",route="/api/v1/users/:id",status="200"} `,
+		`http_requests_total{method="GET",route="unmatched",status="404"} `,
+		// Made up methods cannot create series
+		`http_requests_total{method="other",route="unmatched",status="404"} `,
+		`http_request_duration_seconds_bucket{method="GET",route="/api/v1/users/:id",status="200",le="+Inf"} `,
+		`db_query_duration_seconds_count{operation="query",table="users"} `,
+		"app_users 1\n",
+		`app_assets{type="insight"} 1` + "\n",
+		"app_favourites 1\n",
+		"go_goroutines ",
+	} {
+		assert.Equal(t, true, strings.Contains(body, line))
+	}
+}
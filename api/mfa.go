@@ -0,0 +1,283 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued on TOTP enrollment.
+const RecoveryCodeCount = 10
+
+// respondWithMFAChallenge issues a challenge token for `dbUser`, that has to be
+// exchanged at "/token/mfa" together with a TOTP code for a token with `scopes`.
+func respondWithMFAChallenge(c *gin.Context, dbUser db.User, scopes []string) {
+	tokenString, err := GenerateMFAToken(dbUser.ID, scopes)
+	if err != nil {
+		abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not sign the token."))
+		return
+	}
+	c.PureJSON(http.StatusOK, gin.H{
+		"id":           dbUser.ID,
+		"mfa_required": true,
+		"mfa_token":    tokenString,
+		"expires_in":   MFATokenExpiration.Seconds(),
+	})
+}
+
+// POST /token/mfa
+// PostMFAToken exchanges a challenge token and a TOTP or recovery code for an
+// access token. Each challenge token can be used only once.
+func (uc *UserController) PostMFAToken(c *gin.Context) {
+	var apiChallenge MFAChallenge
+	if err := c.ShouldBindJSON(&apiChallenge); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	claims, err := ParseMFAToken(apiChallenge.MFAToken)
+	if err != nil {
+		abortWithProblem(c, Unauthorized(err.Error()))
+		return
+	}
+	revoked, err := uc.revocations.IsRevoked(&claims.RegisteredClaims)
+	if err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	if revoked {
+		abortWithProblem(c, Unauthorized("Token has been revoked."))
+		return
+	}
+
+	userId, _ := strconv.Atoi(claims.Subject)
+	var dbUser = db.User{ID: uint(userId)}
+	session := uc.GetSession(c)
+	result := session.Limit(1).Find(&dbUser)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 || !dbUser.TOTPEnabled {
+		abortWithProblem(c, Unauthorized("Invalid credentials."))
+		return
+	}
+	if dbUser.Disabled {
+		abortWithProblem(c, accountDisabled())
+		return
+	}
+	if retryAfter := uc.limiter.RetryAfter(dbUser.Username, c.ClientIP()); retryAfter > 0 {
+		abortTooManyRequests(c, retryAfter)
+		return
+	}
+
+	valid, err := verifySecondFactor(session, &dbUser, apiChallenge.Code)
+	if err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	if !valid {
+		uc.limiter.Failure(dbUser.Username, c.ClientIP())
+		abortWithProblem(c, Unauthorized("Invalid two-factor authentication code."))
+		return
+	}
+	uc.limiter.Success(dbUser.Username)
+	if err := uc.revocations.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	scopes := claims.Scopes()
+	if len(scopes) == 0 {
+		scopes = AllScopes
+	}
+	respondWithToken(c, dbUser, scopes)
+}
+
+// POST /users/:id/totp
+// EnrollTOTP generates a new TOTP secret for the user. Two-factor
+// authentication is enabled once the first code is verified.
+func (uc *UserController) EnrollTOTP(c *gin.Context) {
+	dbUser, ok := uc.findOwnUser(c)
+	if !ok {
+		return
+	}
+	if dbUser.TOTPEnabled {
+		abortWithProblem(c, Conflict("Two-factor authentication is already enabled."))
+		return
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not create TOTP secret."))
+		return
+	}
+	session := uc.GetSession(c)
+	result := session.Model(&dbUser).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0})
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusCreated, gin.H{
+		"secret":      secret,
+		"otpauth_url": TOTPURL(dbUser.Username, secret),
+	})
+}
+
+// POST /users/:id/totp/verify
+// VerifyTOTP enables two-factor authentication after checking the first code
+// and returns recovery codes, which are not shown again.
+func (uc *UserController) VerifyTOTP(c *gin.Context) {
+	dbUser, ok := uc.findOwnUser(c)
+	if !ok {
+		return
+	}
+	var apiCode SecondFactor
+	if err := c.ShouldBindJSON(&apiCode); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	if dbUser.TOTPEnabled {
+		abortWithProblem(c, Conflict("Two-factor authentication is already enabled."))
+		return
+	}
+	if dbUser.TOTPSecret == "" {
+		abortWithProblem(c, NewProblem(http.StatusConflict, "Two-factor authentication enrollment has not started."))
+		return
+	}
+	step, valid := ValidateTOTP(dbUser.TOTPSecret, apiCode.Code, time.Now(), dbUser.TOTPLastStep)
+	if !valid {
+		abortWithProblem(c, Unauthorized("Invalid two-factor authentication code."))
+		return
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	dbCodes := make([]db.RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			abortWithProblem(c, NewProblem(http.StatusInternalServerError, "Could not create recovery codes."))
+			return
+		}
+		codes[i] = code
+		dbCodes[i] = db.RecoveryCode{UserID: dbUser.ID, CodeHash: hashRecoveryCode(code)}
+	}
+	session := uc.GetSession(c)
+	err := session.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("user_id = ?", dbUser.ID).Delete(&db.RecoveryCode{}); result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Create(&dbCodes); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&dbUser).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error
+	})
+	if err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	c.PureJSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DELETE /users/:id/totp
+// DisableTOTP turns off two-factor authentication, which requires a valid
+// TOTP or recovery code.
+func (uc *UserController) DisableTOTP(c *gin.Context) {
+	dbUser, ok := uc.findOwnUser(c)
+	if !ok {
+		return
+	}
+	var apiCode SecondFactor
+	if err := c.ShouldBindJSON(&apiCode); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	if !dbUser.TOTPEnabled {
+		abortWithProblem(c, NotFound())
+		return
+	}
+	session := uc.GetSession(c)
+	valid, err := verifySecondFactor(session, &dbUser, apiCode.Code)
+	if err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	if !valid {
+		abortWithProblem(c, Unauthorized("Invalid two-factor authentication code."))
+		return
+	}
+	err = session.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("user_id = ?", dbUser.ID).Delete(&db.RecoveryCode{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&dbUser).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+	})
+	if err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// findOwnUser loads the user in the ":id" path parameter, which has to be
+// the user making the request. Aborts the request and returns false otherwise.
+func (uc *UserController) findOwnUser(c *gin.Context) (db.User, bool) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	if err := VerifyID(c, userId); err != nil {
+		abortWithProblem(c, Forbidden())
+		return db.User{}, false
+	}
+	return uc.findUser(c)
+}
+
+// verifySecondFactor checks `code` as TOTP code of `dbUser`, or as one of its
+// unused recovery codes. The code is consumed, so it cannot be used again.
+func verifySecondFactor(session *gorm.DB, dbUser *db.User, code string) (bool, error) {
+	if step, ok := ValidateTOTP(dbUser.TOTPSecret, code, time.Now(), dbUser.TOTPLastStep); ok {
+		// Only a newer step can be stored, so that concurrent requests cannot
+		// both use the same code
+		result := session.Model(&db.User{}).
+			Where("id = ? AND totp_last_step < ?", dbUser.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		dbUser.TOTPLastStep = step
+		return result.RowsAffected == 1, nil
+	}
+
+	result := session.Model(&db.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", dbUser.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// newRecoveryCode returns a random code formatted as "xxxx-xxxx-xxxx-xxxx".
+func newRecoveryCode() (string, error) {
+	random := make([]byte, 10)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(random))
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// hashRecoveryCode ignores case and separators of `code`.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
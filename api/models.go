@@ -1,14 +1,85 @@
 package api
 
-import "github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+import (
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+)
 
 // This file has API models on which requests are validateds
 
-type User struct {
+// Credentials authenticate an existing user
+type Credentials struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// TokenRequest asks for a token granting `Scopes`, or all scopes if empty
+type TokenRequest struct {
+	Username string   `json:"username" binding:"required"`
+	Password string   `json:"password" binding:"required"`
+	Scopes   []string `json:"scopes" binding:"omitempty,min=1,dive,scope"`
+}
+
+type User struct {
+	Username string `json:"username" binding:"required,username"`
+	Password string `json:"password" binding:"required,max=72,password,unbreached"`
+}
+
+// PublicUser is the profile of a user visible to other users
+type PublicUser struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+func newPublicUser(dbUser db.User) PublicUser {
+	return PublicUser{
+		ID:          dbUser.ID,
+		Username:    dbUser.Username,
+		DisplayName: dbUser.DisplayName,
+		AvatarURL:   dbUser.AvatarURL,
+	}
+}
+
+// Profile is the complete profile, visible only to the user itself
+type Profile struct {
+	PublicUser
+	Email        *string `json:"email"`
+	PendingEmail string  `json:"pending_email,omitempty"`
+	Locale       string  `json:"locale"`
+	Timezone     string  `json:"timezone"`
+}
+
+func newProfile(dbUser db.User) Profile {
+	return Profile{
+		PublicUser:   newPublicUser(dbUser),
+		Email:        dbUser.Email,
+		PendingEmail: dbUser.PendingEmail,
+		Locale:       dbUser.Locale,
+		Timezone:     dbUser.Timezone,
+	}
+}
+
+// ProfileUpdate changes the fields that are set. Empty values clear the
+// field, except for `Email`, which changes only after verification.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=64"`
+	Email       *string `json:"email" binding:"omitempty,max=254,email"`
+	Locale      *string `json:"locale" binding:"omitempty,max=35,locale"`
+	Timezone    *string `json:"timezone" binding:"omitempty,max=64,tz"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,max=2048,avatar"`
+}
+
+type EmailVerificationConfirm struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type RoleChange struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
 func (u *User) getDBUser() (db.User, error) {
 	user := db.User{
 		Username: u.Username,
@@ -17,6 +88,38 @@ func (u *User) getDBUser() (db.User, error) {
 	return user, err
 }
 
+type PasswordChange struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,max=72,password,unbreached"`
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+type PasswordResetConfirm struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,max=72,password,unbreached"`
+}
+
+// SecondFactor is a TOTP code or a recovery code
+type SecondFactor struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAChallenge struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// APIKeyRequest creates an API key, that cannot manage the account itself.
+// `ExpiresAt` defaults to `APIKeyExpiration` from now.
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,scope,ne=account,ne=admin"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
 type Favourite struct {
 	ID uint `json:"id"`
 }
@@ -26,26 +129,28 @@ func (u *Favourite) getDBAsset() (db.Asset, error) {
 	return asset, nil
 }
 
+// Length limits match the column sizes in db package
+
 type Chart struct {
-	Title  string `json:"title"`
-	TitleX string `json:"title_x"`
-	TitleY string `json:"title_y"`
-	Data   string `binding:"base64" json:"data"` // base64
+	Title  string `json:"title" binding:"max=256"`
+	TitleX string `json:"title_x" binding:"max=256"`
+	TitleY string `json:"title_y" binding:"max=256"`
+	Data   string `json:"data" binding:"omitempty,base64"` // base64
 }
 
 type Insight struct {
-	Description string `json:"description"`
+	Description string `json:"description" binding:"max=1024"`
 }
 
 type Characteristic struct {
-	Gender        string `json:"gender" binding:"exists,alphanum,min=1,max=1"`
-	BirthCountry  string `json:"birth_country"`
-	AgeGroupRange string `json:"age_group"`
-	SocMediaHours string `json:"social_media_hours"`
+	Gender        string `json:"gender" binding:"required,alphanum,len=1"`
+	BirthCountry  string `json:"birth_country" binding:"max=64"`
+	AgeGroupRange string `json:"age_group" binding:"max=256"`
+	SocMediaHours string `json:"social_media_hours" binding:"max=256"`
 }
 
 type Audience struct {
-	Characteristics []Characteristic `json:"characteristics"`
+	Characteristics []Characteristic `json:"characteristics" binding:"dive"`
 }
 
 type Asset struct {
@@ -95,3 +200,17 @@ func (a *Asset) getDBAsset() (db.Asset, error) {
 	}
 	return asset, nil
 }
+
+// ClientCertLink names the client certificates to link to a user by the
+// distinguished names of their subject and issuing CA.
+type ClientCertLink struct {
+	Issuer  string `json:"issuer" binding:"required,max=1024"`
+	Subject string `json:"subject" binding:"required,max=1024"`
+}
+
+// GraphQLQuery is the body of `POST /graphql`, as sent by GraphQL clients.
+type GraphQLQuery struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
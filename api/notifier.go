@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a notification for a user, e.g. a password reset token.
+// `Data` holds machine readable values mentioned in `Body`.
+type Message struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	// Email is the address to deliver to, empty if the user has none
+	Email   string            `json:"email,omitempty"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Notifier delivers messages to users, e.g. by e-mail.
+type Notifier interface {
+	Notify(message Message) error
+}
+
+// LogNotifier writes every message as a JSON line to a writer.
+// It is meant for local use, where there is no mail server.
+type LogNotifier struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewLogNotifier creates a notifier writing to `writer`.
+func NewLogNotifier(writer io.Writer) *LogNotifier {
+	return &LogNotifier{writer: writer}
+}
+
+// NewFileNotifier creates a notifier appending messages to the file at `path`.
+func NewFileNotifier(path string) (*LogNotifier, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogNotifier(file), nil
+}
+
+func (n *LogNotifier) Notify(message Message) error {
+	line, err := json.Marshal(struct {
+		Time time.Time `json:"time"`
+		Message
+	}{time.Now(), message})
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.writer.Write(append(line, '\n'))
+	return err
+}
+
+// DefaultNotifier is used by engines created with `CreateEngine`.
+var DefaultNotifier Notifier = NewLogNotifier(os.Stderr)
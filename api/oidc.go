@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDCConfig configures login through an OpenID Connect provider with the
+// authorization code flow.
+type OIDCConfig struct {
+	// Issuer is the provider URL, its configuration is discovered at
+	// "<Issuer>/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back to, it has to
+	// point to the "/api/v1/oidc/callback" route
+	RedirectURL string
+	// Scopes requested in addition to "openid"
+	Scopes []string
+	// HTTPClient used to reach the provider, `http.DefaultClient` if nil
+	HTTPClient *http.Client
+}
+
+// OIDCClaims are the claims of an ID token used for login and provisioning.
+type OIDCClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+}
+
+// oidcDiscovery is the part of the provider configuration that is used.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider is a client of an OpenID Connect provider. The provider keys
+// are cached and reloaded when a token is signed with an unknown key.
+type OIDCProvider struct {
+	config    OIDCConfig
+	discovery oidcDiscovery
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+}
+
+// OIDCKeyRefreshInterval limits how often provider keys are reloaded, so that
+// tokens with made up key ids cannot be used to flood the provider.
+var OIDCKeyRefreshInterval = time.Minute
+
+// NewOIDCProvider discovers the configuration of the provider at `config.Issuer`.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC issuer, client id and redirect URL are required")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	p := &OIDCProvider{config: config, keys: make(map[string]crypto.PublicKey)}
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	// Prevents a provider from issuing tokens in the name of another one
+	if p.discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery: issuer %q does not match %q", p.discovery.Issuer, config.Issuer)
+	}
+	if p.discovery.AuthorizationEndpoint == "" || p.discovery.TokenEndpoint == "" || p.discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery: incomplete provider configuration")
+	}
+	return p, nil
+}
+
+// Issuer returns the issuer identifier of the provider.
+func (p *OIDCProvider) Issuer() string {
+	return p.config.Issuer
+}
+
+// SecureRedirect reports whether the provider sends users back over HTTPS,
+// which is the public scheme of the server also behind a TLS-terminating proxy.
+func (p *OIDCProvider) SecureRedirect() bool {
+	redirect, err := url.Parse(p.config.RedirectURL)
+	return err == nil && strings.EqualFold(redirect.Scheme, "https")
+}
+
+// AuthCodeURL returns the provider URL the user is sent to for login.
+// `verifier` is the PKCE code verifier, see RFC 7636.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange redeems authorization `code` at the token endpoint and returns
+// the verified claims of the ID token. The token has to contain `nonce`.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &response); err != nil {
+		return nil, fmt.Errorf("OIDC token exchange: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("OIDC token exchange: %s %s", response.Error, response.ErrorDescription)
+	}
+	if response.IDToken == "" {
+		return nil, errors.New("OIDC token exchange: no id_token in response")
+	}
+	return p.Verify(ctx, response.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and `nonce` of ID
+// token `idToken`.
+func (p *OIDCProvider) Verify(ctx context.Context, idToken, nonce string) (*OIDCClaims, error) {
+	claims := &OIDCClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		// Shared secrets are not supported, which also rules out algorithm confusion
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(p.config.Issuer, true) {
+		return nil, errors.New("unexpected issuer")
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, errors.New("unexpected audience")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("unexpected nonce")
+	}
+	return claims, nil
+}
+
+// publicKey returns the provider key `kid`, reloading the provider keys if it
+// is unknown. Without `kid` the only provider key is used.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+	p.mu.RLock()
+	recent := time.Since(p.lastFetch) < OIDCKeyRefreshInterval
+	p.mu.RUnlock()
+	if !recent {
+		if err := p.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := p.cachedKey(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *OIDCProvider) cachedKey(kid string) (crypto.PublicKey, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) error {
+	var set JWKSet
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &set); err != nil {
+		return fmt.Errorf("OIDC keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped, others may still be usable
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	p.lastFetch = time.Now()
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.doJSON(req, target)
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, target interface{}) error {
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	// Token endpoint errors are returned with status 400 and a JSON body
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Redacted())
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// stubOIDCProvider is a minimal OpenID Connect provider, that logs in
+// `user` without asking and issues ES256 signed ID tokens.
+type stubOIDCProvider struct {
+	server       *httptest.Server
+	keys         *KeySet
+	clientID     string
+	clientSecret string
+	user         OIDCClaims
+	grants       map[string]url.Values
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeySet(&SigningKey{ID: "stub", Method: jwt.SigningMethodES256, Private: private, Public: &private.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubOIDCProvider{
+		keys:         keys,
+		clientID:     "gwi",
+		clientSecret: "secret",
+		grants:       make(map[string]url.Values),
+	}
+	router := gin.New()
+	router.GET("/.well-known/openid-configuration", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"issuer":                 stub.server.URL,
+			"authorization_endpoint": stub.server.URL + "/authorize",
+			"token_endpoint":         stub.server.URL + "/token",
+			"jwks_uri":               stub.server.URL + "/jwks",
+		})
+	})
+	router.GET("/jwks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, stub.keys.JWKS())
+	})
+	router.GET("/authorize", func(c *gin.Context) {
+		if c.Query("client_id") != stub.clientID || c.Query("code_challenge_method") != "S256" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		code, _ := randomURLString(16)
+		stub.grants[code] = c.Request.URL.Query()
+		c.Redirect(http.StatusFound, c.Query("redirect_uri")+"?"+url.Values{
+			"code":  {code},
+			"state": {c.Query("state")},
+		}.Encode())
+	})
+	router.POST("/token", func(c *gin.Context) {
+		clientID, secret, _ := c.Request.BasicAuth()
+		grant, ok := stub.grants[c.PostForm("code")]
+		delete(stub.grants, c.PostForm("code"))
+		challenge := sha256.Sum256([]byte(c.PostForm("code_verifier")))
+		if clientID != stub.clientID || secret != stub.clientSecret || !ok ||
+			grant.Get("redirect_uri") != c.PostForm("redirect_uri") ||
+			grant.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		claims := stub.user
+		now := time.Now()
+		claims.Issuer = stub.server.URL
+		claims.Audience = jwt.ClaimStrings{stub.clientID}
+		claims.IssuedAt = jwt.NewNumericDate(now)
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Minute))
+		claims.Nonce = grant.Get("nonce")
+		idToken, err := stub.keys.Sign(&claims)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+	})
+	stub.server = httptest.NewServer(router)
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+// useStubOIDCProvider sets `DefaultOIDCProvider` to `stub` until the test ends.
+func useStubOIDCProvider(t *testing.T, stub *stubOIDCProvider) *OIDCProvider {
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		Issuer:       stub.server.URL,
+		ClientID:     stub.clientID,
+		ClientSecret: stub.clientSecret,
+		RedirectURL:  "http://localhost:8080/api/v1/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := DefaultOIDCProvider
+	DefaultOIDCProvider = provider
+	t.Cleanup(func() { DefaultOIDCProvider = previous })
+	return provider
+}
+
+// completeOIDCLogin logs in at the provider URL `authURL` and calls the
+// callback with the state cookie set in `started`.
+func completeOIDCLogin(t *testing.T, router http.Handler, started *httptest.ResponseRecorder, authURL string) *httptest.ResponseRecorder {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range started.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func oidcLogin(t *testing.T, router http.Handler) *httptest.ResponseRecorder {
+	started := performRequest(router, "GET", "/api/v1/oidc/login", nil)
+	assert.Equal(t, http.StatusFound, started.Code)
+	return completeOIDCLogin(t, router, started, started.Header().Get("Location"))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	stub := newStubOIDCProvider(t)
+	stub.user = OIDCClaims{
+		RegisteredClaims:  jwt.RegisteredClaims{Subject: "248289761001"},
+		Email:             "jane.doe@example.com",
+		PreferredUsername: "jane doe",
+	}
+	useStubOIDCProvider(t, stub)
+	router := CreateTestEngine(database, true)
+
+	// The user is provisioned on first login
+	w := oidcLogin(t, router)
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	userId := got["id"].(float64)
+	token := got["token"].(string)
+	w = performAuthRequest(router, "GET", "/api/v1/users/"+strconv.Itoa(int(userId)), token, nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "jane-doe", decodeBody(t, w.Body.Bytes())["username"])
+
+	// And found by the identity afterwards
+	w = oidcLogin(t, router)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, userId, decodeBody(t, w.Body.Bytes())["id"])
+
+	w = performAuthRequest(router, "GET", "/api/v1/users/"+strconv.Itoa(int(userId))+"/identities", token, nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), "248289761001"))
+
+	// Provisioned users have no password
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "jane-doe", "password": "anything1"}))
+	assert.Equal(t, 401, w.Code)
+	// The last identity cannot be unlinked
+	w = performAuthRequest(router, "DELETE", "/api/v1/users/"+strconv.Itoa(int(userId))+"/identities/1", token, nil)
+	assert.Equal(t, 409, w.Code)
+
+	// Taken usernames get a suffix
+	stub.user = OIDCClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "other"}, PreferredUsername: "test"}
+	w = oidcLogin(t, router)
+	assert.Equal(t, 200, w.Code)
+	var dbUser db.User
+	database.Where("username = ?", "test-2").First(&dbUser)
+	assert.Equal(t, decodeBody(t, w.Body.Bytes())["id"], float64(dbUser.ID))
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	stub := newStubOIDCProvider(t)
+	stub.user = OIDCClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "1"}}
+	useStubOIDCProvider(t, stub)
+	router := CreateTestEngine(database, true)
+
+	started := performRequest(router, "GET", "/api/v1/oidc/login", nil)
+	authURL, _ := url.Parse(started.Header().Get("Location"))
+	query := authURL.Query()
+
+	// The state cookie is no access token
+	for _, cookie := range started.Result().Cookies() {
+		assert.Equal(t, OIDCStateCookie, cookie.Name)
+		w := performAuthRequest(router, "GET", "/api/v1/assets", cookie.Value, nil)
+		assert.Equal(t, 401, w.Code)
+	}
+
+	// Without the cookie of the browser that started the login
+	w := performRequest(router, "GET", "/api/v1/oidc/callback?code=x&state="+query.Get("state"), nil)
+	assert.Equal(t, 401, w.Code)
+
+	// With another state
+	query.Set("state", "forged")
+	authURL.RawQuery = query.Encode()
+	w = completeOIDCLogin(t, router, started, authURL.String())
+	assert.Equal(t, 401, w.Code)
+
+	w = performRequest(router, "GET", "/api/v1/oidc/callback?error=access_denied", nil)
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestOIDCStateCookieSecure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := useStubOIDCProvider(t, newStubOIDCProvider(t))
+	router := CreateTestEngine(initDB(), true)
+	stateCookie := func() *http.Cookie {
+		w := performRequest(router, "GET", "/api/v1/oidc/login", nil)
+		cookies := w.Result().Cookies()
+		assert.Equal(t, 1, len(cookies))
+		return cookies[0]
+	}
+	assert.Equal(t, false, stateCookie().Secure)
+
+	// Plain HTTP from a proxy terminating TLS of the public HTTPS URL
+	provider.config.RedirectURL = "https://api.example.com/api/v1/oidc/callback"
+	assert.Equal(t, true, stateCookie().Secure)
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	stub := newStubOIDCProvider(t)
+	stub.user = OIDCClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "sso-test"}, Email: "test@example.com"}
+	useStubOIDCProvider(t, stub)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	started := performAuthRequest(router, "POST", "/api/v1/users/1/identities", token, nil)
+	assert.Equal(t, 200, started.Code)
+	authURL := decodeBody(t, started.Body.Bytes())["authorization_url"].(string)
+	w := completeOIDCLogin(t, router, started, authURL)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "test@example.com", decodeBody(t, w.Body.Bytes())["email"])
+
+	// Login with the identity is the linked user
+	w = oidcLogin(t, router)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, float64(1), decodeBody(t, w.Body.Bytes())["id"])
+
+	// Identities belong to a single user
+	started = performAuthRequest(router, "POST", "/api/v1/users/1/identities", token, nil)
+	authURL = decodeBody(t, started.Body.Bytes())["authorization_url"].(string)
+	w = completeOIDCLogin(t, router, started, authURL)
+	assert.Equal(t, 409, w.Code)
+
+	// The user still has a password, so the identity can be unlinked
+	w = performAuthRequest(router, "DELETE", "/api/v1/users/1/identities/1", token, nil)
+	assert.Equal(t, 204, w.Code)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	provider := useStubOIDCProvider(t, stub)
+	now := time.Now()
+	claims := OIDCClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    stub.server.URL,
+			Subject:   "1",
+			Audience:  jwt.ClaimStrings{stub.clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce: "nonce",
+	}
+	idToken, err := stub.keys.Sign(&claims)
+	assert.Equal(t, err, nil)
+	_, err = provider.Verify(context.Background(), idToken, "nonce")
+	assert.Equal(t, err, nil)
+	_, err = provider.Verify(context.Background(), idToken, "other")
+	assert.NotEqual(t, err, nil)
+
+	claims.Audience = jwt.ClaimStrings{"someone-else"}
+	idToken, _ = stub.keys.Sign(&claims)
+	_, err = provider.Verify(context.Background(), idToken, "nonce")
+	assert.NotEqual(t, err, nil)
+
+	// Tokens signed by our own keys are not accepted as provider tokens
+	claims.Audience = jwt.ClaimStrings{stub.clientID}
+	idToken, _ = jwtKeys.Sign(&claims)
+	_, err = provider.Verify(context.Background(), idToken, "nonce")
+	assert.NotEqual(t, err, nil)
+}
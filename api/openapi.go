@@ -0,0 +1,63 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIYAML describes every route of `createEngine`. It is maintained by
+// hand together with the handlers and models.
+//
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+//go:embed swagger.html
+var swaggerHTML []byte
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+	openAPIErr  error
+)
+
+// OpenAPIDocument returns the OpenAPI 3 document of the API as JSON.
+func OpenAPIDocument() ([]byte, error) {
+	openAPIOnce.Do(func() {
+		var document map[string]interface{}
+		if openAPIErr = yaml.Unmarshal(openAPIYAML, &document); openAPIErr != nil {
+			return
+		}
+		openAPIJSON, openAPIErr = json.Marshal(document)
+	})
+	return openAPIJSON, openAPIErr
+}
+
+// GET /openapi.json
+func GetOpenAPI(c *gin.Context) {
+	document, err := OpenAPIDocument()
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", document)
+}
+
+// swaggerAssets serves the files of Swagger UI below "/docs/".
+var swaggerAssets = http.StripPrefix("/docs", http.FileServer(swaggerFiles.HTTP))
+
+// GET /docs/*filepath
+// SwaggerUI serves Swagger UI showing "/openapi.json".
+func SwaggerUI(c *gin.Context) {
+	switch c.Param("filepath") {
+	case "/", "/index.html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerHTML)
+	default:
+		swaggerAssets.ServeHTTP(c.Writer, c.Request)
+	}
+}
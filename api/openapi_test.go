@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func loadOpenAPI(t *testing.T) *openapi3.T {
+	document, err := OpenAPIDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := openapi3.NewLoader().LoadFromData(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// ginParam matches the path parameters of gin routes, e.g. ":id"
+var ginParam = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// openAPIPath converts the gin route `path` to its OpenAPI path template.
+func openAPIPath(path string) string {
+	// Only the index of Swagger UI is documented
+	path = strings.Replace(path, "*filepath", "", 1)
+	return ginParam.ReplaceAllString(path, "{$1}")
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Routes of single sign-on are only registered with a provider
+	useStubOIDCProvider(t, newStubOIDCProvider(t))
+	router := CreateTestEngine(initDB(), true)
+	spec := loadOpenAPI(t)
+
+	documented := map[string]bool{}
+	for path, item := range spec.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+	var missing []string
+	for _, route := range router.Routes() {
+		operation := route.Method + " " + openAPIPath(route.Path)
+		if !documented[operation] {
+			missing = append(missing, operation)
+		}
+		delete(documented, operation)
+	}
+	var stale []string
+	for operation := range documented {
+		stale = append(stale, operation)
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	// Routes missing in openapi.yaml
+	assert.Equal(t, []string(nil), missing)
+	// Operations in openapi.yaml without route
+	assert.Equal(t, []string(nil), stale)
+}
+
+func TestOpenAPIRequestModels(t *testing.T) {
+	spec := loadOpenAPI(t)
+
+	// Operations with a JSON body report the problems of their handler
+	var missing []string
+	for _, item := range spec.Paths.Map() {
+		for _, operation := range item.Operations() {
+			if operation.RequestBody == nil || operation.RequestBody.Value.Content.Get("application/json") == nil {
+				continue
+			}
+			if _, ok := requestModels[operation.OperationID]; !ok {
+				missing = append(missing, operation.OperationID)
+			}
+		}
+	}
+	sort.Strings(missing)
+	assert.Equal(t, []string(nil), missing)
+}
+
+func TestGetOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := CreateTestEngine(initDB(), true)
+
+	w := performRequest(router, "GET", "/openapi.json", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	spec, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+	assert.Equal(t, nil, err)
+	for _, schema := range []string{"User", "Asset", "Chart", "Insight", "Audience"} {
+		assert.NotEqual(t, nil, spec.Components.Schemas[schema])
+	}
+
+	w = performRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), "../openapi.json"))
+	w = performRequest(router, "GET", "/docs/swagger-ui-bundle.js", nil)
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "GET", "/docs/missing.js", nil)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token, _ := GenerateJWT(1)
+
+	w := performRequest(router, "POST", "/api/v1/users", jsonBody(t, gin.H{"username": 42}))
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	problem := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, ProblemTypeValidation, problem.Type)
+	assert.Equal(t, "/api/v1/users", problem.Instance)
+	assert.Equal(t, 2, len(problem.Errors))
+	pointers := []string{problem.Errors[0].Pointer, problem.Errors[1].Pointer}
+	sort.Strings(pointers)
+	assert.Equal(t, []string{"/password", "/username"}, pointers)
+
+	// Parameters are named in the detail
+	w = performAuthRequest(router, "GET", "/api/v1/users/one", token, nil)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, true, strings.Contains(decodeProblem(t, w.Body.Bytes()).Detail, `parameter "id"`))
+
+	// Credentials and scopes are checked before the request
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users?page_size=1000", token, nil)
+	assert.Equal(t, 403, w.Code)
+	w = performRequest(router, "POST", "/api/v1/assets", jsonBody(t, gin.H{"chart": gin.H{"title": 42}}))
+	assert.Equal(t, 401, w.Code)
+	readOnly, _ := GenerateScopedJWT(1, []string{ScopeAssetsRead})
+	w = performAuthRequest(router, "POST", "/api/v1/assets", readOnly, jsonBody(t, gin.H{"chart": gin.H{"title": 42}}))
+	assert.Equal(t, 403, w.Code)
+
+	// Bodies failing the validation of the handler get its problem
+	w = performAuthRequest(router, "POST", "/api/v1/assets", token, jsonBody(t, gin.H{"audience": gin.H{
+		"characteristics": []gin.H{{"gender": "Male"}},
+	}}))
+	assert.Equal(t, 400, w.Code)
+	problem = decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, 1, len(problem.Errors))
+	assert.Equal(t, FieldError{
+		Pointer: "/audience/characteristics/0/gender",
+		Rule:    "len",
+		Message: "gender must be 1 character in length",
+	}, problem.Errors[0])
+
+	// Valid requests and paths outside of the document are passed on
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "GET", "/docs/swagger-ui.css", nil)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestOpenAPIValidatorResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	validator, err := OpenAPIValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(validator)
+	// A handler drifting from the document
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": 1})
+	})
+	router.GET("/readyz", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ready"})
+	})
+
+	w := performRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, 500, w.Code)
+	problem := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, true, strings.Contains(problem.Detail, "Response does not match the API description"))
+	w = performRequest(router, "GET", "/readyz", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "ready", decodeBody(t, w.Body.Bytes())["status"])
+
+	// Responses are only checked in test mode
+	gin.SetMode(gin.ReleaseMode)
+	defer gin.SetMode(gin.TestMode)
+	w = performRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, 200, w.Code)
+}
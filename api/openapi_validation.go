@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ValidateRequests turns on `OpenAPIValidator` in engines created afterwards.
+var ValidateRequests = false
+
+// requestModels create the models the handlers bind the bodies of the
+// operations to, see `invalidRequest`.
+var requestModels = map[string]func() interface{}{
+	"createUser":               func() interface{} { return &User{} },
+	"createToken":              func() interface{} { return &TokenRequest{} },
+	"createMFAToken":           func() interface{} { return &MFAChallenge{} },
+	"restoreUser":              func() interface{} { return &Credentials{} },
+	"requestPasswordReset":     func() interface{} { return &PasswordResetRequest{} },
+	"confirmPasswordReset":     func() interface{} { return &PasswordResetConfirm{} },
+	"confirmEmailVerification": func() interface{} { return &EmailVerificationConfirm{} },
+	"updateProfile":            func() interface{} { return &ProfileUpdate{} },
+	"changePassword":           func() interface{} { return &PasswordChange{} },
+	"disableTOTP":              func() interface{} { return &SecondFactor{} },
+	"verifyTOTP":               func() interface{} { return &SecondFactor{} },
+	"createAPIKey":             func() interface{} { return &APIKeyRequest{} },
+	"addFavourite":             func() interface{} { return &Favourite{} },
+	"createAsset":              func() interface{} { return &Asset{} },
+	"putAsset":                 func() interface{} { return &Asset{} },
+	"patchAsset":               func() interface{} { return &Asset{} },
+	"graphql":                  func() interface{} { return &GraphQLQuery{} },
+	"adminPutRole":             func() interface{} { return &RoleChange{} },
+	"adminLinkClientCert":      func() interface{} { return &ClientCertLink{} },
+}
+
+// OpenAPIValidator returns a middleware refusing requests that do not match
+// the OpenAPI document with a 400 validation problem, in addition to the
+// binding of the handlers. In gin test mode, responses are checked too and
+// answered with 500 if they do not match, so that tests catch drift between
+// the handlers and the document. Paths that are not documented are passed on.
+// Add it after authentication, so that credentials are checked first.
+func OpenAPIValidator() (gin.HandlerFunc, error) {
+	document, err := OpenAPIDocument()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := openapi3.NewLoader().LoadFromData(document)
+	if err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, err
+	}
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+	options := &openapi3filter.Options{
+		MultiError:            true,
+		IncludeResponseStatus: true,
+		// Credentials are checked by `AuthMiddleware`
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			respondWithProblem(c, invalidRequest(c, route.Operation.OperationID, err))
+			return
+		}
+		if gin.Mode() != gin.TestMode {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		// Problems are rendered here, so that they are validated too
+		renderError(c)
+		c.Writer = writer.ResponseWriter
+		err = openapi3filter.ValidateResponse(c.Request.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 writer.Status(),
+			Header:                 writer.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(writer.body.Bytes())),
+			Options:                options,
+		})
+		if err != nil {
+			RequestLogger(c).Error("response does not match the OpenAPI document", "error", err.Error())
+			c.Writer.Header().Del("Location")
+			respondWithProblem(c, *NewProblem(http.StatusInternalServerError,
+				"Response does not match the API description: "+err.Error()))
+			return
+		}
+		c.Writer.WriteHeaderNow()
+		c.Writer.Write(writer.body.Bytes())
+	}, nil
+}
+
+// invalidRequest returns the problem of a request of `operationId`, which
+// violates the document with `err`. Bodies failing the validation of their
+// model get the problem of `InvalidInput`, like in the handler.
+func invalidRequest(c *gin.Context, operationId string, err error) Problem {
+	if newModel, ok := requestModels[operationId]; ok {
+		var validationErrors validator.ValidationErrors
+		if bindErr := c.ShouldBindJSON(newModel()); errors.As(bindErr, &validationErrors) {
+			return *InvalidInput(c, bindErr)
+		}
+	}
+	return requestProblem(err)
+}
+
+// requestProblem lists the violations of the document in `err` like
+// `InvalidInput`. Violations of parameters are named in the detail.
+func requestProblem(err error) Problem {
+	problem := Problem{
+		Type:   ProblemTypeValidation,
+		Title:  "Your request is not valid.",
+		Status: http.StatusBadRequest,
+		Detail: "One or more fields failed validation.",
+	}
+	var details []string
+	var collect func(err error)
+	collect = func(err error) {
+		var multi openapi3.MultiError
+		var requestErr *openapi3filter.RequestError
+		var schemaErr *openapi3.SchemaError
+		switch {
+		case errors.As(err, &multi):
+			for _, inner := range multi {
+				collect(inner)
+			}
+		case errors.As(err, &requestErr) && requestErr.Parameter != nil:
+			details = append(details, requestErr.Error())
+		case errors.As(err, &requestErr) && requestErr.Err != nil && requestErr.Err != err:
+			collect(requestErr.Err)
+		case errors.As(err, &schemaErr):
+			problem.Errors = append(problem.Errors, FieldError{
+				Pointer: "/" + strings.Join(schemaErr.JSONPointer(), "/"),
+				Rule:    schemaErr.SchemaField,
+				Message: schemaErr.Reason,
+			})
+		default:
+			details = append(details, err.Error())
+		}
+	}
+	collect(err)
+	if len(details) > 0 {
+		problem.Detail = strings.Join(details, "; ")
+	}
+	return problem
+}
+
+// bufferedWriter keeps the body of the response until it is validated.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow is deferred until the response is validated, so that the
+// status can still be replaced.
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
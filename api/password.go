@@ -0,0 +1,226 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PasswordResetExpiration is how long a password reset token can be used.
+const PasswordResetExpiration = 30 * time.Minute
+
+// PUT /users/:id/password
+// ChangePassword sets a new password after verifying the old one.
+// All existing tokens of the user are revoked and a new token is returned.
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	id := c.Param("id")
+	userId, _ := strconv.Atoi(id)
+	err := VerifyID(c, userId)
+	if err != nil {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	var apiChange PasswordChange
+	if err := c.ShouldBindJSON(&apiChange); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+
+	var dbUser = db.User{ID: uint(userId)}
+	session := uc.GetSession(c)
+	result := session.Limit(1).Find(&dbUser)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithProblem(c, NotFound())
+		return
+	}
+	if dbUser.CheckPassword(apiChange.OldPassword) != nil {
+		abortWithProblem(c, Unauthorized("Invalid credentials."))
+		return
+	}
+
+	if err := uc.updatePassword(session, &dbUser, apiChange.NewPassword); err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	// The new token is not granted more than the one used for the change
+	respondWithToken(c, dbUser, requestScopes(c))
+}
+
+// updatePassword saves `password` of `dbUser`, which fulfills a forced reset,
+// and revokes all of its tokens.
+// Returns a problem, if the password cannot be set.
+func (uc *UserController) updatePassword(session *gorm.DB, dbUser *db.User, password string) error {
+	if err := savePassword(session, dbUser, password); err != nil {
+		return err
+	}
+	if err := uc.revocations.RevokeUser(dbUser.ID); err != nil {
+		return DBProblem(err)
+	}
+	return nil
+}
+
+// savePassword saves `password` of `dbUser`, which fulfills a forced reset.
+// Returns a problem, if the password cannot be set.
+func savePassword(session *gorm.DB, dbUser *db.User, password string) error {
+	if err := dbUser.SetPassword(password); err != nil {
+		return NewProblem(http.StatusBadRequest, "Invalid input: "+err.Error())
+	}
+	result := session.Model(dbUser).Updates(map[string]interface{}{
+		"password":            dbUser.PasswordHash,
+		"must_reset_password": false,
+	})
+	if result.Error != nil {
+		return DBProblem(result.Error)
+	}
+	return nil
+}
+
+// POST /password-reset
+// RequestPasswordReset sends a single-use reset token to the user through
+// the notifier. The response does not reveal whether the user exists.
+// Requests are throttled per username and client IP by `DefaultResetLimits`.
+func (uc *UserController) RequestPasswordReset(c *gin.Context) {
+	var apiRequest PasswordResetRequest
+	if err := c.ShouldBindJSON(&apiRequest); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	if retryAfter := uc.resetLimiter.RetryAfter(apiRequest.Username, c.ClientIP()); retryAfter > 0 {
+		abortThrottled(c, retryAfter, "Too many password reset requests")
+		return
+	}
+	// Counted before the lookup, so that unknown users are throttled alike
+	uc.resetLimiter.Failure(apiRequest.Username, c.ClientIP())
+
+	var dbUser db.User
+	session := uc.GetSession(c)
+	result := session.Where("username = ?", apiRequest.Username).Limit(1).Find(&dbUser)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		if err := uc.sendPasswordReset(session, dbUser); err != nil {
+			abortWithProblem(c, err)
+			return
+		}
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// sendPasswordReset creates a reset token for `dbUser` and notifies the user.
+func (uc *UserController) sendPasswordReset(session *gorm.DB, dbUser db.User) error {
+	token, tokenHash, err := newOneTimeToken()
+	if err != nil {
+		return NewProblem(http.StatusInternalServerError, "Could not create reset token.")
+	}
+	reset := db.PasswordReset{
+		UserID:    dbUser.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(PasswordResetExpiration),
+	}
+	if result := session.Create(&reset); result.Error != nil {
+		return DBProblem(result.Error)
+	}
+	err = uc.notifier.Notify(Message{
+		UserID:   dbUser.ID,
+		Username: dbUser.Username,
+		Email:    emailOf(dbUser),
+		Subject:  "Password reset",
+		Body: fmt.Sprintf(
+			"Use the token %s to set a new password within %s. If you did not ask for a password reset, ignore this message.",
+			token, PasswordResetExpiration,
+		),
+		Data: map[string]string{"token": token},
+	})
+	if err != nil {
+		return NewProblem(http.StatusInternalServerError, "Could not deliver reset token.")
+	}
+	return nil
+}
+
+// POST /password-reset/confirm
+// ConfirmPasswordReset sets a new password using a reset token.
+// The token, and any other outstanding token of the user, cannot be used again.
+func (uc *UserController) ConfirmPasswordReset(c *gin.Context) {
+	var apiConfirm PasswordResetConfirm
+	if err := c.ShouldBindJSON(&apiConfirm); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+
+	var reset db.PasswordReset
+	tokenHash := hashOneTimeToken(apiConfirm.Token)
+	now := time.Now()
+	session := uc.GetSession(c)
+	err := session.Transaction(func(tx *gorm.DB) error {
+		// Claiming the token first lets only one of concurrent confirmations
+		// through
+		result := tx.Model(&db.PasswordReset{}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return DBProblem(result.Error)
+		}
+		if result.RowsAffected != 1 {
+			return Unauthorized("Invalid or expired reset token.")
+		}
+		result = tx.Preload("User").Where("token_hash = ?", tokenHash).Limit(1).Find(&reset)
+		if result.Error != nil {
+			return DBProblem(result.Error)
+		}
+		// Reset of deleted user leaves an empty preloaded user
+		if reset.User.ID == 0 {
+			return Unauthorized("Invalid or expired reset token.")
+		}
+		if err := savePassword(tx, &reset.User, apiConfirm.NewPassword); err != nil {
+			return err
+		}
+		result = tx.Model(&db.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return DBProblem(result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	// The revocation store does not take part in the transaction
+	if err := uc.revocations.RevokeUser(reset.User.ID); err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// newOneTimeToken returns a random token, e.g. for password reset, and its
+// hash to be stored.
+func newOneTimeToken() (token string, tokenHash string, err error) {
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(random)
+	return token, hashOneTimeToken(token), nil
+}
+
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+// recordingNotifier keeps sent messages for inspection in tests
+type recordingNotifier struct {
+	messages []Message
+}
+
+func (n *recordingNotifier) Notify(message Message) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func jsonBody(t *testing.T, payload gin.H) io.ReadCloser {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return io.NopCloser(bytes.NewBuffer(data))
+}
+
+func TestChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	w := performAuthRequest(router, "PUT", "/api/v1/users/1/password", token, jsonBody(t, gin.H{
+		"old_password": "wrong",
+		"new_password": "newpass1",
+	}))
+	assert.Equal(t, 401, w.Code)
+
+	w = performAuthRequest(router, "PUT", "/api/v1/users/1/password", token, jsonBody(t, gin.H{
+		"old_password": "testpass1",
+		"new_password": "newpass1",
+	}))
+	assert.Equal(t, 200, w.Code)
+	var got gin.H
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Old token is revoked, the returned one works
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 401, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", got["token"].(string), nil)
+	assert.Equal(t, 200, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "newpass1"}))
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestPasswordReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	notifier := &recordingNotifier{}
+	previous := DefaultNotifier
+	DefaultNotifier = notifier
+	defer func() { DefaultNotifier = previous }()
+	router := CreateTestEngine(database, true)
+
+	// Unknown users get the same response without a message
+	w := performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": "nobody"}))
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, 0, len(notifier.messages))
+
+	w = performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": "test"}))
+	assert.Equal(t, 202, w.Code)
+	w = performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": "test"}))
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, 2, len(notifier.messages))
+	message := notifier.messages[0]
+	assert.Equal(t, uint(1), message.UserID)
+	resetToken := message.Data["token"]
+	assert.Equal(t, true, strings.Contains(message.Body, resetToken))
+
+	w = performRequest(router, "POST", "/api/v1/password-reset/confirm", jsonBody(t, gin.H{
+		"token":        "invalid",
+		"new_password": "resetpass1",
+	}))
+	assert.Equal(t, 401, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/password-reset/confirm", jsonBody(t, gin.H{
+		"token":        resetToken,
+		"new_password": "resetpass1",
+	}))
+	assert.Equal(t, 204, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "resetpass1"}))
+	assert.Equal(t, 200, w.Code)
+
+	// Reset tokens are single use, and the other outstanding token is void too
+	for _, sent := range notifier.messages {
+		w = performRequest(router, "POST", "/api/v1/password-reset/confirm", jsonBody(t, gin.H{
+			"token":        sent.Data["token"],
+			"new_password": "again1234",
+		}))
+		assert.Equal(t, 401, w.Code)
+	}
+}
+
+func TestPasswordResetConcurrentConfirmations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	// Every connection to ":memory:" opens a database of its own
+	sqlDB, err := database.DB()
+	assert.Equal(t, nil, err)
+	sqlDB.SetMaxOpenConns(1)
+	notifier := &recordingNotifier{}
+	previous := DefaultNotifier
+	DefaultNotifier = notifier
+	defer func() { DefaultNotifier = previous }()
+	router := CreateTestEngine(database, true)
+
+	w := performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": "test"}))
+	assert.Equal(t, 202, w.Code)
+	resetToken := notifier.messages[0].Data["token"]
+
+	// Only one of the confirmations can use the token
+	const confirmations = 8
+	codes := make(chan int, confirmations)
+	var wg sync.WaitGroup
+	for i := 0; i < confirmations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := performRequest(router, "POST", "/api/v1/password-reset/confirm", jsonBody(t, gin.H{
+				"token":        resetToken,
+				"new_password": "resetpass1",
+			}))
+			codes <- req.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{204: 1, 401: confirmations - 1}, counts)
+}
+
+func TestPasswordResetThrottling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	notifier := &recordingNotifier{}
+	previous := DefaultNotifier
+	DefaultNotifier = notifier
+	defer func() { DefaultNotifier = previous }()
+	router := CreateTestEngine(database, true)
+
+	// Unknown users are throttled like existing ones
+	for _, username := range []string{"test", "nobody"} {
+		for i := 0; i < DefaultResetLimits.AccountThreshold; i++ {
+			w := performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": username}))
+			assert.Equal(t, 202, w.Code)
+		}
+		w := performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": username}))
+		assert.Equal(t, 429, w.Code)
+		assert.Equal(t, "900", w.Header().Get("Retry-After"))
+	}
+	assert.Equal(t, DefaultResetLimits.AccountThreshold, len(notifier.messages))
+
+	// Other usernames are refused once the client IP reached its limit
+	for i := 2 * DefaultResetLimits.AccountThreshold; i < DefaultResetLimits.IPThreshold; i++ {
+		w := performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": fmt.Sprintf("user%d", i)}))
+		assert.Equal(t, 202, w.Code)
+	}
+	w := performRequest(router, "POST", "/api/v1/password-reset", jsonBody(t, gin.H{"username": "another"}))
+	assert.Equal(t, 429, w.Code)
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buffer bytes.Buffer
+	notifier := NewLogNotifier(&buffer)
+	err := notifier.Notify(Message{UserID: 1, Username: "test", Subject: "Hello"})
+	assert.Equal(t, err, nil)
+
+	var got gin.H
+	err = json.Unmarshal(buffer.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello", got["subject"])
+	assert.Equal(t, "test", got["username"])
+}
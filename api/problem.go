@@ -0,0 +1,178 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// ProblemContentType is the media type of error responses, see RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// Problem types with additional semantics, any other problem is "about:blank".
+const (
+	ProblemTypeBlank      = "about:blank"
+	ProblemTypeValidation = "/problems/validation-error"
+	ProblemTypeConflict   = "/problems/conflict"
+)
+
+// Problem is an RFC 7807 problem details object.
+// It is used as error by handlers and rendered by `ErrorHandler`.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a single invalid field of the request payload.
+// `Pointer` is a JSON pointer to the field in the request body.
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// NewProblem creates a problem of type "about:blank" titled after `status`.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   ProblemTypeBlank,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Unauthorized creates a 401 problem with `detail`.
+func Unauthorized(detail string) *Problem {
+	return NewProblem(http.StatusUnauthorized, detail)
+}
+
+// Forbidden creates a 403 problem for resources of other users.
+func Forbidden() *Problem {
+	return NewProblem(http.StatusForbidden, "You do not have access to this resource.")
+}
+
+// accountDisabled is returned for correct credentials of a disabled user, so
+// that the user knows to contact an administrator.
+func accountDisabled() *Problem {
+	return NewProblem(http.StatusForbidden, "Account is disabled.")
+}
+
+// NotFound creates a 404 problem for the requested resource.
+func NotFound() *Problem {
+	return NewProblem(http.StatusNotFound, "The requested resource does not exist.")
+}
+
+// Conflict creates a 409 problem for resources violating uniqueness.
+func Conflict(detail string) *Problem {
+	return &Problem{
+		Type:   ProblemTypeConflict,
+		Title:  "Resource already exists.",
+		Status: http.StatusConflict,
+		Detail: detail,
+	}
+}
+
+// InvalidInput creates a 400 problem from a binding or model conversion error.
+// Validation errors are listed field by field, with messages translated
+// according to the "Accept-Language" header of `c`.
+func InvalidInput(c *gin.Context, err error) *Problem {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return NewProblem(http.StatusBadRequest, "Invalid input: "+err.Error())
+	}
+	problem := &Problem{
+		Type:   ProblemTypeValidation,
+		Title:  "Your request is not valid.",
+		Status: http.StatusBadRequest,
+		Detail: "One or more fields failed validation.",
+	}
+	trans := requestTranslator(c)
+	for _, fieldError := range validationErrors {
+		problem.Errors = append(problem.Errors, FieldError{
+			Pointer: jsonPointer(fieldError.Namespace()),
+			Rule:    fieldError.Tag(),
+			Message: fieldError.Translate(trans),
+		})
+	}
+	return problem
+}
+
+// DBProblem maps a database error to a problem.
+// Missing records result in 404, unique constraint violations in 409 and
+// anything else in 500 without leaking the database error to the client.
+func DBProblem(err error) *Problem {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound()
+	}
+	if isUniqueViolation(err) {
+		return Conflict("A resource with the same unique fields already exists.")
+	}
+	return NewProblem(http.StatusInternalServerError, "Database operation failed.")
+}
+
+// isUniqueViolation checks the error message since this gorm version does not
+// translate driver errors. Covers sqlite, postgres and mysql.
+func isUniqueViolation(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "UNIQUE constraint failed") ||
+		strings.Contains(message, "duplicate key value") ||
+		strings.Contains(message, "Duplicate entry")
+}
+
+// abortWithProblem aborts the request chain and hands `err` to `ErrorHandler`.
+func abortWithProblem(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// ErrorHandler provides a handler function that renders the last error added
+// to the context as `application/problem+json`.
+// Errors that are not a `*Problem` are rendered as 500 without details.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		renderError(c)
+	}
+}
+
+// renderError renders the last error added to `c`, unless a response was
+// already written.
+func renderError(c *gin.Context) {
+	ginError := c.Errors.Last()
+	if ginError == nil || c.Writer.Written() {
+		return
+	}
+	var problem Problem
+	var cause *Problem
+	if errors.As(ginError.Err, &cause) {
+		problem = *cause
+	} else {
+		problem = *NewProblem(http.StatusInternalServerError, "")
+	}
+	respondWithProblem(c, problem)
+}
+
+// respondWithProblem aborts with `problem` as `application/problem+json`,
+// for middlewares that cannot rely on `ErrorHandler`.
+func respondWithProblem(c *gin.Context, problem Problem) {
+	if problem.Instance == "" {
+		problem.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
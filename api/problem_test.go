@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func decodeProblem(t *testing.T, body []byte) Problem {
+	var problem Problem
+	err := json.Unmarshal(body, &problem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return problem
+}
+
+func TestProblemConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, false)
+
+	data, err := json.Marshal(gin.H{"username": "test", "password": "testpass1"})
+	assert.Equal(t, err, nil)
+	w := performRequest(router, "POST", "/api/v1/users", io.NopCloser(bytes.NewBuffer(data)))
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	problem := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, ProblemTypeConflict, problem.Type)
+	assert.Equal(t, 409, problem.Status)
+	assert.Equal(t, "Username is already taken.", problem.Detail)
+	assert.Equal(t, "/api/v1/users", problem.Instance)
+}
+
+func TestProblemValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	router := CreateTestEngine(database, false)
+
+	data, err := json.Marshal(gin.H{"username": "test"})
+	assert.Equal(t, err, nil)
+	w := performRequest(router, "POST", "/api/v1/users", io.NopCloser(bytes.NewBuffer(data)))
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	problem := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, ProblemTypeValidation, problem.Type)
+	assert.Equal(t, 1, len(problem.Errors))
+	assert.Equal(t, "/password", problem.Errors[0].Pointer)
+	assert.Equal(t, "required", problem.Errors[0].Rule)
+}
+
+func TestProblemStatuses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	w := performRequest(router, "GET", "/api/v1/users", nil)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, "No Access token provided.", decodeProblem(t, w.Body.Bytes()).Detail)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	w = performAuthRequest(router, "GET", "/api/v1/users/2/favourites", token, nil)
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, ProblemTypeBlank, decodeProblem(t, w.Body.Bytes()).Type)
+
+	w = performAuthRequest(router, "GET", "/api/v1/assets/42", token, nil)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "/api/v1/assets/42", decodeProblem(t, w.Body.Bytes()).Instance)
+
+	w = performRequest(router, "GET", "/api/v1/nothing", nil)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmailVerificationExpiration is how long an email verification token can be used.
+const EmailVerificationExpiration = 24 * time.Hour
+
+// PATCH /users/:id
+// PatchUserByID updates the profile of the user. A new email is only set
+// once confirmed with the token sent to it, until then it is pending.
+func (uc *UserController) PatchUserByID(c *gin.Context) {
+	var apiUpdate ProfileUpdate
+	if err := c.ShouldBindJSON(&apiUpdate); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	dbUser, ok := uc.findOwnUser(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if apiUpdate.DisplayName != nil {
+		updates["display_name"] = strings.TrimSpace(*apiUpdate.DisplayName)
+	}
+	if apiUpdate.Locale != nil {
+		updates["locale"] = *apiUpdate.Locale
+	}
+	if apiUpdate.Timezone != nil {
+		updates["timezone"] = *apiUpdate.Timezone
+	}
+	if apiUpdate.AvatarURL != nil {
+		updates["avatar_url"] = *apiUpdate.AvatarURL
+	}
+	var newEmail string
+	// Emails are unique regardless of case
+	if apiUpdate.Email != nil && *apiUpdate.Email != "" && strings.ToLower(*apiUpdate.Email) != emailOf(dbUser) {
+		newEmail = strings.ToLower(*apiUpdate.Email)
+		updates["pending_email"] = newEmail
+	}
+
+	session := uc.GetSession(c)
+	if len(updates) > 0 {
+		if result := session.Model(&dbUser).Updates(updates); result.Error != nil {
+			abortWithProblem(c, DBProblem(result.Error))
+			return
+		}
+	}
+	if newEmail != "" {
+		if err := uc.sendEmailVerification(session, dbUser, newEmail); err != nil {
+			abortWithProblem(c, err)
+			return
+		}
+	}
+	c.PureJSON(http.StatusOK, newProfile(dbUser))
+}
+
+// sendEmailVerification creates a verification token for `email` and sends it there.
+// Tokens sent to previous pending emails cannot be used anymore.
+func (uc *UserController) sendEmailVerification(session *gorm.DB, dbUser db.User, email string) error {
+	token, tokenHash, err := newOneTimeToken()
+	if err != nil {
+		return NewProblem(http.StatusInternalServerError, "Could not create verification token.")
+	}
+	result := session.Model(&db.EmailVerification{}).
+		Where("user_id = ? AND used_at IS NULL", dbUser.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return DBProblem(result.Error)
+	}
+	verification := db.EmailVerification{
+		UserID:    dbUser.ID,
+		Email:     email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(EmailVerificationExpiration),
+	}
+	if result := session.Create(&verification); result.Error != nil {
+		return DBProblem(result.Error)
+	}
+	err = uc.notifier.Notify(Message{
+		UserID:   dbUser.ID,
+		Username: dbUser.Username,
+		Email:    email,
+		Subject:  "Email verification",
+		Body: fmt.Sprintf(
+			"Use the token %s to confirm your email address within %s. If you did not change your email, ignore this message.",
+			token, EmailVerificationExpiration,
+		),
+		Data: map[string]string{"token": token},
+	})
+	if err != nil {
+		return NewProblem(http.StatusInternalServerError, "Could not deliver verification token.")
+	}
+	return nil
+}
+
+// POST /email-verification/confirm
+// ConfirmEmailVerification sets the email of the user, that the token was sent to.
+func (uc *UserController) ConfirmEmailVerification(c *gin.Context) {
+	var apiConfirm EmailVerificationConfirm
+	if err := c.ShouldBindJSON(&apiConfirm); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+
+	var verification db.EmailVerification
+	tokenHash := hashOneTimeToken(apiConfirm.Token)
+	now := time.Now()
+	session := uc.GetSession(c)
+	err := session.Transaction(func(tx *gorm.DB) error {
+		// Claiming the token first lets only one of concurrent confirmations
+		// through
+		result := tx.Model(&db.EmailVerification{}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return DBProblem(result.Error)
+		}
+		if result.RowsAffected != 1 {
+			return Unauthorized("Invalid or expired verification token.")
+		}
+		result = tx.Preload("User").Where("token_hash = ?", tokenHash).Limit(1).Find(&verification)
+		if result.Error != nil {
+			return DBProblem(result.Error)
+		}
+		// Verification of deleted user leaves an empty preloaded user, and
+		// the token has to be for the email still pending
+		if verification.User.ID == 0 || verification.User.PendingEmail != verification.Email {
+			return Unauthorized("Invalid or expired verification token.")
+		}
+		result = tx.Model(&verification.User).Updates(map[string]interface{}{
+			"email":         verification.Email,
+			"pending_email": "",
+		})
+		if result.Error != nil && isUniqueViolation(result.Error) {
+			return Conflict("Email is already in use.")
+		}
+		if result.Error != nil {
+			return DBProblem(result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// emailOf returns the verified email of `dbUser`, or "" if there is none.
+func emailOf(dbUser db.User) string {
+	if dbUser.Email == nil {
+		return ""
+	}
+	return *dbUser.Email
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestPatchProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	w := performAuthRequest(router, "PATCH", "/api/v1/users/1", token, jsonBody(t, gin.H{
+		"display_name": " Test User ",
+		"locale":       "fr-FR",
+		"timezone":     "Europe/Athens",
+		"avatar_url":   "https://example.com/avatar.png",
+	}))
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "Test User", got["display_name"])
+	assert.Equal(t, "fr-FR", got["locale"])
+	assert.Equal(t, "Europe/Athens", got["timezone"])
+	assert.Equal(t, nil, got["email"])
+
+	// Fields that are not sent are kept, empty ones are cleared
+	w = performAuthRequest(router, "PATCH", "/api/v1/users/1", token, jsonBody(t, gin.H{"avatar_url": ""}))
+	assert.Equal(t, 200, w.Code)
+	got = decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "Test User", got["display_name"])
+	assert.Equal(t, nil, got["avatar_url"])
+
+	for _, invalid := range []gin.H{
+		{"locale": "not a locale"},
+		{"timezone": "Mars/Olympus"},
+		{"avatar_url": "javascript:alert(1)"},
+		{"email": "not-an-email"},
+	} {
+		w = performAuthRequest(router, "PATCH", "/api/v1/users/1", token, jsonBody(t, invalid))
+		assert.Equal(t, 400, w.Code)
+	}
+
+	// Other users cannot change the profile
+	other, err := GenerateJWT(2)
+	assert.Equal(t, err, nil)
+	w = performAuthRequest(router, "PATCH", "/api/v1/users/1", other, jsonBody(t, gin.H{"display_name": "x"}))
+	assert.Equal(t, 403, w.Code)
+}
+
+func TestGetProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	w := performRequest(router, "POST", "/api/v1/users", jsonBody(t, gin.H{"username": "other", "password": "otherpass1"}))
+	assert.Equal(t, 201, w.Code)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	w = performAuthRequest(router, "PATCH", "/api/v1/users/1", token, jsonBody(t, gin.H{
+		"display_name": "Test User",
+		"timezone":     "UTC",
+	}))
+	assert.Equal(t, 200, w.Code)
+
+	// Other users see only the public profile
+	other, err := GenerateJWT(2)
+	assert.Equal(t, err, nil)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", other, nil)
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "Test User", got["display_name"])
+	_, hasTimezone := got["timezone"]
+	assert.Equal(t, false, hasTimezone)
+
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 200, w.Code)
+	got = decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "UTC", got["timezone"])
+}
+
+func TestEmailVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	notifier := &recordingNotifier{}
+	previous := DefaultNotifier
+	DefaultNotifier = notifier
+	defer func() { DefaultNotifier = previous }()
+	router := CreateTestEngine(database, true)
+	w := performRequest(router, "POST", "/api/v1/users", jsonBody(t, gin.H{"username": "other", "password": "otherpass1"}))
+	assert.Equal(t, 201, w.Code)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	w = performAuthRequest(router, "PATCH", "/api/v1/users/1", token, jsonBody(t, gin.H{"email": "test@example.com"}))
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, nil, got["email"])
+	assert.Equal(t, "test@example.com", got["pending_email"])
+	assert.Equal(t, 1, len(notifier.messages))
+	message := notifier.messages[0]
+	assert.Equal(t, "test@example.com", message.Email)
+
+	w = performRequest(router, "POST", "/api/v1/email-verification/confirm", jsonBody(t, gin.H{"token": "invalid"}))
+	assert.Equal(t, 401, w.Code)
+	w = performRequest(router, "POST", "/api/v1/email-verification/confirm", jsonBody(t, gin.H{"token": message.Data["token"]}))
+	assert.Equal(t, 204, w.Code)
+	// Tokens are single use
+	w = performRequest(router, "POST", "/api/v1/email-verification/confirm", jsonBody(t, gin.H{"token": message.Data["token"]}))
+	assert.Equal(t, 401, w.Code)
+
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	got = decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "test@example.com", got["email"])
+	_, hasPending := got["pending_email"]
+	assert.Equal(t, false, hasPending)
+
+	// The email of another user cannot be taken, regardless of case
+	other, err := GenerateJWT(2)
+	assert.Equal(t, err, nil)
+	w = performAuthRequest(router, "PATCH", "/api/v1/users/2", other, jsonBody(t, gin.H{"email": "Test@Example.com"}))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "test@example.com", decodeBody(t, w.Body.Bytes())["pending_email"])
+	assert.Equal(t, 2, len(notifier.messages))
+	w = performRequest(router, "POST", "/api/v1/email-verification/confirm", jsonBody(t, gin.H{"token": notifier.messages[1].Data["token"]}))
+	assert.Equal(t, 409, w.Code)
+
+	// Only the token for the latest pending email can be used
+	w = performAuthRequest(router, "PATCH", "/api/v1/users/2", other, jsonBody(t, gin.H{"email": "other@example.com"}))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 3, len(notifier.messages))
+	w = performRequest(router, "POST", "/api/v1/email-verification/confirm", jsonBody(t, gin.H{"token": notifier.messages[1].Data["token"]}))
+	assert.Equal(t, 401, w.Code)
+	w = performRequest(router, "POST", "/api/v1/email-verification/confirm", jsonBody(t, gin.H{"token": notifier.messages[2].Data["token"]}))
+	assert.Equal(t, 204, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/2", other, nil)
+	assert.Equal(t, "other@example.com", decodeBody(t, w.Body.Bytes())["email"])
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginLimits configure lockout of failed logins.
+// After `AccountThreshold` failures for a username, or `IPThreshold` failures
+// from a client IP, logins are locked for `BaseLockout`. Every further failure
+// doubles the lockout up to `MaxLockout`. Failures are forgotten after
+// `Window` passes without another failure.
+type LoginLimits struct {
+	AccountThreshold int
+	IPThreshold      int
+	BaseLockout      time.Duration
+	MaxLockout       time.Duration
+	Window           time.Duration
+}
+
+// DefaultLoginLimits are used by engines created with `CreateEngine`.
+var DefaultLoginLimits = LoginLimits{
+	AccountThreshold: 5,
+	IPThreshold:      20,
+	BaseLockout:      30 * time.Second,
+	MaxLockout:       1 * time.Hour,
+	Window:           15 * time.Minute,
+}
+
+// DefaultResetLimits throttle password reset requests, which are counted
+// like failed logins whether the user exists or not.
+var DefaultResetLimits = LoginLimits{
+	AccountThreshold: 3,
+	IPThreshold:      10,
+	BaseLockout:      15 * time.Minute,
+	MaxLockout:       24 * time.Hour,
+	Window:           time.Hour,
+}
+
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter counts failed logins per account and per client IP in memory.
+type LoginLimiter struct {
+	limits    LoginLimits
+	mu        sync.Mutex
+	failures  map[string]*loginFailures
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLoginLimiter creates a limiter enforcing `limits`.
+func NewLoginLimiter(limits LoginLimits) *LoginLimiter {
+	return &LoginLimiter{
+		limits:   limits,
+		failures: make(map[string]*loginFailures),
+		now:      time.Now,
+	}
+}
+
+func accountKey(username string) string {
+	return "account:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter returns how long logins of `username` from `ip` stay locked.
+// Zero means the login may be attempted.
+func (l *LoginLimiter) RetryAfter(username, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var retryAfter time.Duration
+	for _, key := range []string{accountKey(username), ipKey(ip)} {
+		if failures, ok := l.failures[key]; ok {
+			if remaining := failures.lockedUntil.Sub(now); remaining > retryAfter {
+				retryAfter = remaining
+			}
+		}
+	}
+	return retryAfter
+}
+
+// Failure records a failed login of `username` from `ip`.
+func (l *LoginLimiter) Failure(username, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	l.record(accountKey(username), l.limits.AccountThreshold, now)
+	l.record(ipKey(ip), l.limits.IPThreshold, now)
+}
+
+// Success forgets failed logins of `username`. Failures of the client IP
+// are kept, so that a single valid account cannot unlock guessing of others.
+func (l *LoginLimiter) Success(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, accountKey(username))
+}
+
+func (l *LoginLimiter) record(key string, threshold int, now time.Time) {
+	failures, ok := l.failures[key]
+	if !ok || now.Sub(failures.lastFailure) > l.limits.Window {
+		failures = &loginFailures{}
+		l.failures[key] = failures
+	}
+	failures.count++
+	failures.lastFailure = now
+	if threshold > 0 && failures.count >= threshold {
+		failures.lockedUntil = now.Add(l.lockout(failures.count - threshold))
+	}
+}
+
+// lockout doubles `BaseLockout` for every failure over the threshold.
+func (l *LoginLimiter) lockout(excess int) time.Duration {
+	lockout := float64(l.limits.BaseLockout) * math.Pow(2, float64(excess))
+	if lockout > float64(l.limits.MaxLockout) {
+		return l.limits.MaxLockout
+	}
+	return time.Duration(lockout)
+}
+
+// sweep drops expired counters at most once per `Window`.
+func (l *LoginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.limits.Window {
+		return
+	}
+	l.lastSweep = now
+	for key, failures := range l.failures {
+		if now.Sub(failures.lastFailure) > l.limits.Window && now.After(failures.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+}
+
+// abortTooManyRequests aborts with 429 and "Retry-After" set to `retryAfter`
+// rounded up to whole seconds.
+func abortTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	abortThrottled(c, retryAfter, "Too many failed login attempts")
+}
+
+// abortThrottled aborts with 429 like `abortTooManyRequests`, the detail
+// starting with `reason`.
+func abortThrottled(c *gin.Context, retryAfter time.Duration, reason string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	abortWithProblem(c, NewProblem(http.StatusTooManyRequests, reason+", try again in "+strconv.Itoa(seconds)+" seconds."))
+}
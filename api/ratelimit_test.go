@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewLoginLimiter(LoginLimits{
+		AccountThreshold: 2,
+		IPThreshold:      3,
+		BaseLockout:      time.Minute,
+		MaxLockout:       3 * time.Minute,
+		Window:           time.Hour,
+	})
+	limiter.now = func() time.Time { return now }
+
+	limiter.Failure("alice", "10.0.0.1")
+	assert.Equal(t, time.Duration(0), limiter.RetryAfter("alice", "10.0.0.1"))
+	limiter.Failure("alice", "10.0.0.1")
+	assert.Equal(t, time.Minute, limiter.RetryAfter("alice", "10.0.0.1"))
+	// Progressive lockout
+	limiter.Failure("alice", "10.0.0.2")
+	assert.Equal(t, 2*time.Minute, limiter.RetryAfter("alice", "10.0.0.2"))
+	limiter.Failure("alice", "10.0.0.2")
+	assert.Equal(t, 3*time.Minute, limiter.RetryAfter("alice", "10.0.0.2"))
+
+	// Other accounts are locked only from the IP over its threshold
+	limiter.Failure("bob", "10.0.0.1")
+	assert.Equal(t, time.Minute, limiter.RetryAfter("carol", "10.0.0.1"))
+	assert.Equal(t, time.Duration(0), limiter.RetryAfter("carol", "10.0.0.3"))
+
+	limiter.Success("alice")
+	assert.Equal(t, time.Duration(0), limiter.RetryAfter("alice", "10.0.0.3"))
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, time.Duration(0), limiter.RetryAfter("carol", "10.0.0.1"))
+}
+
+func TestPostTokenLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	wrong, err := json.Marshal(gin.H{"username": "test", "password": "wrong"})
+	assert.Equal(t, err, nil)
+	for i := 0; i < DefaultLoginLimits.AccountThreshold; i++ {
+		w := performRequest(router, "POST", "/api/v1/token", io.NopCloser(bytes.NewBuffer(wrong)))
+		assert.Equal(t, 401, w.Code)
+	}
+
+	credentials, err := json.Marshal(gin.H{"username": "test", "password": "testpass1"})
+	assert.Equal(t, err, nil)
+	w := performRequest(router, "POST", "/api/v1/token", io.NopCloser(bytes.NewBuffer(credentials)))
+	assert.Equal(t, 429, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+}
+
+func TestPostTokenLockoutIgnoresForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	login := func(router *gin.Engine, i int) int {
+		req, _ := http.NewRequest("POST", "/api/v1/token", jsonBody(t, gin.H{"username": fmt.Sprintf("user%d", i), "password": "wrong"}))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A new forwarded address per attempt does not escape the limit of the peer
+	router := CreateTestEngine(database, true)
+	for i := 0; i < DefaultLoginLimits.IPThreshold; i++ {
+		assert.Equal(t, 401, login(router, i))
+	}
+	assert.Equal(t, 429, login(router, DefaultLoginLimits.IPThreshold))
+
+	// Unless the peer is a trusted proxy
+	TrustedProxies = []string{"192.0.2.1"}
+	t.Cleanup(func() { TrustedProxies = nil })
+	router = CreateTestEngine(database, true)
+	for i := 0; i <= DefaultLoginLimits.IPThreshold; i++ {
+		assert.Equal(t, 401, login(router, i))
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationRefreshInterval is how often a `RevocationStore` reloads
+// revocations from the database, picking up changes made by other instances.
+var RevocationRefreshInterval = 10 * time.Second
+
+// RevocationStore keeps revoked tokens in the database and caches all of the
+// revocations that are still relevant in memory, so that checking a token
+// does not hit the database on every request.
+type RevocationStore struct {
+	db          *gorm.DB
+	mu          sync.RWMutex
+	tokens      map[string]time.Time
+	users       map[string]time.Time
+	lastRefresh time.Time
+}
+
+// NewRevocationStore creates a store backed by `database`.
+func NewRevocationStore(database *gorm.DB) *RevocationStore {
+	return &RevocationStore{
+		db:     database,
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+// RevokeToken revokes the single token identified by "jti" `tokenId`.
+func (s *RevocationStore) RevokeToken(tokenId string, expiresAt time.Time) error {
+	revoked := db.RevokedToken{ID: tokenId, ExpiresAt: expiresAt}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[tokenId] = expiresAt
+	return nil
+}
+
+// RevokeUser revokes all tokens of user `userId` issued until now.
+func (s *RevocationStore) RevokeUser(userId uint) error {
+	// Issue times have limited precision, see `jwt.TimePrecision`
+	revocation := db.TokenRevocation{UserID: userId, RevokedAt: time.Now().Truncate(jwt.TimePrecision)}
+	result := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&revocation)
+	if result.Error != nil {
+		return result.Error
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[strconv.FormatUint(uint64(userId), 10)] = revocation.RevokedAt
+	return nil
+}
+
+// IsRevoked checks whether the token with `claims` was revoked, either by
+// its "jti" or by revocation of all tokens of its subject.
+func (s *RevocationStore) IsRevoked(claims *jwt.RegisteredClaims) (bool, error) {
+	if err := s.refreshIfStale(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.tokens[claims.ID]; ok {
+		return true, nil
+	}
+	if revokedAt, ok := s.users[claims.Subject]; ok {
+		// Tokens without issue time cannot prove they are newer. Parsing "iat"
+		// as float can truncate it by one unit of `jwt.TimePrecision`, so
+		// tokens issued in the same unit as revocation are considered older.
+		if claims.IssuedAt == nil || !claims.IssuedAt.Add(jwt.TimePrecision).After(revokedAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *RevocationStore) refreshIfStale() error {
+	s.mu.RLock()
+	stale := time.Since(s.lastRefresh) > RevocationRefreshInterval
+	s.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+	return s.Refresh()
+}
+
+// Refresh reloads the cache from the database and removes revocations
+// of tokens that have expired anyway. Revocations cached meanwhile, e.g. by
+// a concurrent `RevokeUser` after the database was read, are kept.
+func (s *RevocationStore) Refresh() error {
+	now := time.Now()
+	// Any token issued before this has expired
+	oldest := now.Add(-TokenExpiration)
+	result := s.db.Where("expires_at < ?", now).Delete(&db.RevokedToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	result = s.db.Where("revoked_at < ?", oldest).Delete(&db.TokenRevocation{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var revokedTokens []db.RevokedToken
+	if result = s.db.Find(&revokedTokens); result.Error != nil {
+		return result.Error
+	}
+	var revocations []db.TokenRevocation
+	if result = s.db.Find(&revocations); result.Error != nil {
+		return result.Error
+	}
+
+	tokens := make(map[string]time.Time, len(revokedTokens))
+	for _, token := range revokedTokens {
+		tokens[token.ID] = token.ExpiresAt
+	}
+	users := make(map[string]time.Time, len(revocations))
+	for _, revocation := range revocations {
+		users[strconv.FormatUint(uint64(revocation.UserID), 10)] = revocation.RevokedAt
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for tokenId, expiresAt := range s.tokens {
+		if _, ok := tokens[tokenId]; !ok && !expiresAt.Before(now) {
+			tokens[tokenId] = expiresAt
+		}
+	}
+	for userId, revokedAt := range s.users {
+		if revokedAt.After(users[userId]) && !revokedAt.Before(oldest) {
+			users[userId] = revokedAt
+		}
+	}
+	s.tokens = tokens
+	s.users = users
+	s.lastRefresh = now
+	return nil
+}
+
+// POST /logout
+// Logout revokes the token used to authorize the request.
+func (uc *UserController) Logout(c *gin.Context) {
+	value, ok := c.Get("jwt_claims")
+	claims, _ := value.(*Claims)
+	if !ok || claims == nil {
+		abortWithProblem(c, Unauthorized("No Access token provided."))
+		return
+	}
+	expiresAt := time.Now().Add(TokenExpiration)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := uc.revocations.RevokeToken(claims.ID, expiresAt); err != nil {
+		abortWithProblem(c, DBProblem(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	other, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	w := performAuthRequest(router, "POST", "/api/v1/logout", token, nil)
+	assert.Equal(t, 204, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, "Token has been revoked.", decodeProblem(t, w.Body.Bytes()).Detail)
+
+	// Other sessions of the user are not affected
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", other, nil)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestDeleteUserRevokesTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	other, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	w := performAuthRequest(router, "DELETE", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 204, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/assets", other, nil)
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestRevocationStoreRefresh(t *testing.T) {
+	database := initDB()
+	first := NewRevocationStore(database)
+	second := NewRevocationStore(database)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	claims, err := ParseToken(token)
+	assert.Equal(t, err, nil)
+
+	revoked, err := second.IsRevoked(&claims.RegisteredClaims)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, false, revoked)
+
+	assert.Equal(t, first.RevokeToken(claims.ID, claims.ExpiresAt.Time), nil)
+	// Expired revocations are dropped on refresh
+	assert.Equal(t, first.RevokeToken("expired", time.Now().Add(-time.Minute)), nil)
+
+	// The other instance sees revocation after refresh
+	assert.Equal(t, second.Refresh(), nil)
+	revoked, err = second.IsRevoked(&claims.RegisteredClaims)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, true, revoked)
+
+	var count int64
+	database.Model(&db.RevokedToken{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Tokens issued after revocation of the user stay valid
+	assert.Equal(t, first.RevokeUser(2), nil)
+	time.Sleep(2 * time.Millisecond)
+	token, err = GenerateJWT(2)
+	assert.Equal(t, err, nil)
+	claims, err = ParseToken(token)
+	assert.Equal(t, err, nil)
+	revoked, err = first.IsRevoked(&claims.RegisteredClaims)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, false, revoked)
+}
+
+func TestRevocationStoreRefreshKeepsConcurrentRevocations(t *testing.T) {
+	database := initDB()
+	store := NewRevocationStore(database)
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	claims, err := ParseToken(token)
+	assert.Equal(t, err, nil)
+
+	// A revocation cached by `RevokeUser` after `Refresh` read the database
+	// is not in the snapshot of the refresh
+	store.users["1"] = time.Now().Add(time.Second)
+	store.tokens["cached"] = time.Now().Add(time.Minute)
+	assert.Equal(t, nil, store.Refresh())
+	revoked, err := store.IsRevoked(&claims.RegisteredClaims)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, true, revoked)
+	_, ok := store.tokens["cached"]
+	assert.Equal(t, true, ok)
+
+	// Expired revocations are still dropped
+	store.tokens["expired"] = time.Now().Add(-time.Minute)
+	assert.Equal(t, nil, store.Refresh())
+	_, ok = store.tokens["expired"]
+	assert.Equal(t, false, ok)
+}
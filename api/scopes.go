@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Scopes limit what a credential can do on behalf of its user
+const (
+	// ScopeAccount allows managing the account itself, e.g. its password,
+	// two-factor authentication and API keys
+	ScopeAccount         = "account"
+	ScopeUsersRead       = "users:read"
+	ScopeAssetsRead      = "assets:read"
+	ScopeAssetsWrite     = "assets:write"
+	ScopeFavouritesRead  = "favourites:read"
+	ScopeFavouritesWrite = "favourites:write"
+	// ScopeAdmin allows administration of other users, if the user has the
+	// admin role
+	ScopeAdmin = "admin"
+)
+
+// AllScopes lists every known scope.
+var AllScopes = []string{
+	ScopeAccount,
+	ScopeUsersRead,
+	ScopeAssetsRead,
+	ScopeAssetsWrite,
+	ScopeFavouritesRead,
+	ScopeFavouritesWrite,
+	ScopeAdmin,
+}
+
+// scopesKey is the context key with the scopes granted to the request.
+// Requests without it are granted no scope.
+const scopesKey = "auth_scopes"
+
+// RequireScopes aborts with 403 status, unless the credential of the request
+// was granted all of `scopes`.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := requestScopes(c)
+		for _, scope := range scopes {
+			if !containsScope(granted, scope) {
+				abortWithProblem(c, NewProblem(http.StatusForbidden, fmt.Sprintf("Missing required scope %q.", scope)))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// requestScopes returns the scopes granted to the request.
+func requestScopes(c *gin.Context) []string {
+	scopes, _ := c.Get(scopesKey)
+	granted, _ := scopes.([]string)
+	return granted
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// isScope checks that the field is one of `AllScopes`.
+func isScope(fl validator.FieldLevel) bool {
+	return containsScope(AllScopes, fl.Field().String())
+}
+
+// joinScopes and splitScopes convert scopes to and from the space separated
+// form used in storage.
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func splitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
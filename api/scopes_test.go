@@ -0,0 +1,84 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestScopedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	w := performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{
+		"username": "test",
+		"password": "testpass1",
+		"scopes":   []string{ScopeAssetsRead, ScopeFavouritesRead},
+	}))
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, "assets:read favourites:read", got["scope"])
+	token := got["token"].(string)
+
+	w = performAuthRequest(router, "GET", "/api/v1/assets", token, nil)
+	assert.Equal(t, 200, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1/favourites", token, nil)
+	assert.NotEqual(t, 403, w.Code)
+	w = performAuthRequest(router, "POST", "/api/v1/assets", token, jsonBody(t, gin.H{"insight": gin.H{"description": "d"}}))
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), ScopeAssetsWrite))
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 403, w.Code)
+	w = performAuthRequest(router, "PUT", "/api/v1/users/1/password", token, jsonBody(t, gin.H{
+		"old_password": "testpass1",
+		"new_password": "newpass1",
+	}))
+	assert.Equal(t, 403, w.Code)
+	// Logging out needs no scope
+	w = performAuthRequest(router, "POST", "/api/v1/logout", token, nil)
+	assert.Equal(t, 204, w.Code)
+
+	// Without requested scopes the token has all of them
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, strings.Join(AllScopes, " "), decodeBody(t, w.Body.Bytes())["scope"])
+
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{
+		"username": "test",
+		"password": "testpass1",
+		"scopes":   []string{"assets:admin"},
+	}))
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestUnscopedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	// Tokens without the "scope" claim are granted no scope
+	now := time.Now()
+	token, err := jwtKeys.Sign(&jwt.RegisteredClaims{
+		ID:        "unscoped",
+		Subject:   "1",
+		Audience:  jwt.ClaimStrings{AccessAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	})
+	assert.Equal(t, err, nil)
+	w := performAuthRequest(router, "GET", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 403, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1/api-keys", token, nil)
+	assert.Equal(t, 403, w.Code)
+	got := performGraphQL(t, router, token, `{ assets { edges { cursor } } }`, nil)
+	_, status := graphQLError(t, got)
+	assert.Equal(t, float64(403), status)
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// DefaultOIDCProvider enables login through an OpenID Connect provider.
+// Login with the provider is disabled while it is nil.
+var DefaultOIDCProvider *OIDCProvider
+
+const (
+	// OIDCStateCookie keeps the state of a login until the provider redirects back
+	OIDCStateCookie = "oidc_state"
+	// OIDCStateExpiration is how long the user has to log in at the provider
+	OIDCStateExpiration = 10 * time.Minute
+	oidcStateAudience   = "oidc-state"
+)
+
+// oidcStateKeys sign the state cookie. They are separate from `jwtKeys`, so
+// that the cookie can never pass for an access token.
+// Until `SetOIDCStateSecret` is called, a random secret is used, so a login
+// has to complete at the instance it was started at.
+var oidcStateKeys = randomKeySet()
+
+// SetOIDCStateSecret sets the HS256 secret of the state cookie, which has to
+// be shared by all instances.
+func SetOIDCStateSecret(secret []byte) error {
+	key, err := NewSigningKey("oidc-state", AlgHS256, secret)
+	if err != nil {
+		return err
+	}
+	ks, err := NewKeySet(key)
+	if err != nil {
+		return err
+	}
+	oidcStateKeys = ks
+	return nil
+}
+
+// oidcState is stored in a signed cookie for the duration of a login, so
+// that the callback can check it belongs to a login started by this browser.
+type oidcState struct {
+	jwt.RegisteredClaims
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// LinkUserID is set when linking an identity to an existing user
+	LinkUserID uint `json:"link_user_id,omitempty"`
+}
+
+// GET /oidc/login
+// OIDCLogin redirects to the provider to log in.
+func (uc *UserController) OIDCLogin(c *gin.Context) {
+	authURL, err := uc.startOIDCLogin(c, 0)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// POST /users/:id/identities
+// LinkIdentity starts a login at the provider, which links the identity to
+// the user instead of logging in. Returns the URL to send the user to.
+func (uc *UserController) LinkIdentity(c *gin.Context) {
+	id := c.Param("id")
+	userId, _ := strconv.Atoi(id)
+	if err := VerifyID(c, userId); err != nil {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	authURL, err := uc.startOIDCLogin(c, uint(userId))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// startOIDCLogin sets the state cookie and returns the provider login URL.
+func (uc *UserController) startOIDCLogin(c *gin.Context, linkUserId uint) (string, error) {
+	state, err := randomURLString(16)
+	if err != nil {
+		return "", NewProblem(http.StatusInternalServerError, "Could not start login.")
+	}
+	nonce, err := randomURLString(16)
+	if err != nil {
+		return "", NewProblem(http.StatusInternalServerError, "Could not start login.")
+	}
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return "", NewProblem(http.StatusInternalServerError, "Could not start login.")
+	}
+	now := time.Now()
+	cookie, err := oidcStateKeys.Sign(&oidcState{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        state,
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(OIDCStateExpiration)),
+		},
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserID: linkUserId,
+	})
+	if err != nil {
+		return "", NewProblem(http.StatusInternalServerError, "Could not start login.")
+	}
+	uc.setOIDCStateCookie(c, cookie, int(OIDCStateExpiration.Seconds()))
+	return uc.oidc.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// GET /oidc/callback
+// OIDCCallback completes the login at the provider. Unknown identities get
+// a new user, unless the login was started by `LinkIdentity`.
+func (uc *UserController) OIDCCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		abortWithProblem(c, Unauthorized("Login at the identity provider failed: "+providerError))
+		return
+	}
+	cookie, err := c.Cookie(OIDCStateCookie)
+	if err != nil {
+		abortWithProblem(c, Unauthorized("No login in progress."))
+		return
+	}
+	// The state is single use
+	uc.setOIDCStateCookie(c, "", -1)
+	state := &oidcState{}
+	_, err = jwt.ParseWithClaims(cookie, state, oidcStateKeys.Keyfunc)
+	if err != nil || !state.VerifyAudience(oidcStateAudience, true) || state.ID != c.Query("state") {
+		abortWithProblem(c, Unauthorized("Invalid login state."))
+		return
+	}
+	claims, err := uc.oidc.Exchange(c.Request.Context(), c.Query("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		abortWithProblem(c, Unauthorized(err.Error()))
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		uc.linkIdentity(c, state.LinkUserID, claims)
+		return
+	}
+	var identity db.ExternalIdentity
+	session := uc.GetSession(c)
+	result := session.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).Limit(1).Find(&identity)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	var dbUser db.User
+	if result.RowsAffected == 0 {
+		if dbUser, err = uc.provisionUser(session, claims); err != nil {
+			abortWithProblem(c, err)
+			return
+		}
+	} else {
+		result = session.Limit(1).Find(&dbUser, identity.UserID)
+		if result.Error != nil {
+			abortWithProblem(c, DBProblem(result.Error))
+			return
+		}
+		// The linked user is in the trash
+		if result.RowsAffected == 0 {
+			abortWithProblem(c, Unauthorized("Invalid credentials."))
+			return
+		}
+	}
+	if dbUser.Disabled {
+		abortWithProblem(c, accountDisabled())
+		return
+	}
+	if dbUser.TOTPEnabled {
+		respondWithMFAChallenge(c, dbUser, AllScopes)
+		return
+	}
+	respondWithToken(c, dbUser, AllScopes)
+}
+
+// linkIdentity links the identity in `claims` to user `userId`.
+func (uc *UserController) linkIdentity(c *gin.Context, userId uint, claims *OIDCClaims) {
+	identity := db.ExternalIdentity{
+		UserID:  userId,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+	session := uc.GetSession(c)
+	result := session.Create(&identity)
+	if result.Error != nil && isUniqueViolation(result.Error) {
+		abortWithProblem(c, Conflict("Identity is already linked to a user."))
+		return
+	}
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/api/v1/users/%d/identities/%d", userId, identity.ID))
+	c.PureJSON(http.StatusCreated, identity)
+}
+
+// maxProvisioningAttempts limits the username suffixes tried for a new user.
+const maxProvisioningAttempts = 20
+
+// provisionUser creates a user without password for the identity in `claims`.
+// The username is derived from the claims and made unique with a suffix.
+// Users are never matched by email, since the provider may not verify it.
+func (uc *UserController) provisionUser(session *gorm.DB, claims *OIDCClaims) (db.User, error) {
+	base := provisionedUsername(claims)
+	for attempt := 1; attempt <= maxProvisioningAttempts; attempt++ {
+		username := base
+		if attempt > 1 {
+			suffix := "-" + strconv.Itoa(attempt)
+			if len(username)+len(suffix) > 32 {
+				username = username[:32-len(suffix)]
+			}
+			username += suffix
+		}
+		dbUser := db.User{Username: username}
+		err := session.Transaction(func(tx *gorm.DB) error {
+			if result := tx.Create(&dbUser); result.Error != nil {
+				return result.Error
+			}
+			return tx.Create(&db.ExternalIdentity{
+				UserID:  dbUser.ID,
+				Issuer:  claims.Issuer,
+				Subject: claims.Subject,
+				Email:   claims.Email,
+			}).Error
+		})
+		if err == nil {
+			return dbUser, nil
+		}
+		if !isUniqueViolation(err) {
+			return dbUser, DBProblem(err)
+		}
+	}
+	return db.User{}, Conflict("Could not find a free username.")
+}
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// provisionedUsername picks a username matching the "username" validation
+// from the "preferred_username" or "email" claims.
+func provisionedUsername(claims *OIDCClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	candidate = invalidUsernameChars.ReplaceAllString(candidate, "-")
+	candidate = strings.TrimLeft(candidate, "_.-")
+	if len(candidate) > 32 {
+		candidate = candidate[:32]
+	}
+	if len(candidate) < 3 {
+		candidate = "user" + candidate
+	}
+	return candidate
+}
+
+// GET /users/:id/identities
+func (uc *UserController) GetIdentities(c *gin.Context) {
+	id := c.Param("id")
+	userId, _ := strconv.Atoi(id)
+	if err := VerifyID(c, userId); err != nil {
+		abortWithProblem(c, Forbidden())
+		return
+	}
+	identities := []db.ExternalIdentity{}
+	session := uc.GetSession(c)
+	result := session.Where("user_id = ?", userId).Find(&identities)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusOK, identities)
+}
+
+// DELETE /users/:id/identities/:identityId
+// DeleteIdentity unlinks an identity. The last identity of a user without
+// password cannot be unlinked, since the user could not log in anymore.
+func (uc *UserController) DeleteIdentity(c *gin.Context) {
+	dbUser, ok := uc.findOwnUser(c)
+	if !ok {
+		return
+	}
+	identityId, _ := strconv.Atoi(c.Param("identityId"))
+	session := uc.GetSession(c)
+	var count int64
+	result := session.Model(&db.ExternalIdentity{}).Where("user_id = ?", dbUser.ID).Count(&count)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if dbUser.PasswordHash == "" && count <= 1 {
+		abortWithProblem(c, Conflict("Set a password before unlinking the last identity."))
+		return
+	}
+	result = session.Where("id = ? AND user_id = ?", identityId, dbUser.ID).Delete(&db.ExternalIdentity{})
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithProblem(c, NotFound())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// setOIDCStateCookie sets the state cookie, which is only sent over HTTPS
+// when the redirect URL of the provider is HTTPS, or the request came over TLS.
+func (uc *UserController) setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || uc.oidc.SecureRedirect()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(OIDCStateCookie, value, maxAge, "/api/v1", "", secure, true)
+}
+
+func randomURLString(size int) (string, error) {
+	random := make([]byte, size)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
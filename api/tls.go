@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CertReloader serves a certificate loaded from files, which can be replaced
+// on disk, e.g. on renewal, without restarting the server.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the PEM certificate chain in `certFile` and its key in `keyFile`.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate serves the current certificate, see `tls.Config`.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the files again, if either was modified since the last load.
+// The current certificate is kept, if the files are invalid, e.g. while
+// only one of them has been replaced yet.
+func (r *CertReloader) Reload() error {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && !modTime.After(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the certificate every `interval` until `ctx` is done.
+// Errors are passed to `onError`, if set.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Reload(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadCertPool reads the PEM certificates in `path`, e.g. of the CAs issuing
+// client certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + path)
+	}
+	return pool, nil
+}
+
+// RedirectToHTTPS returns a handler that permanently redirects plaintext
+// requests to the same URL on the HTTPS port `httpsPort`.
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// No port in the request
+			host = strings.Trim(r.Host, "[]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// ClientCertIssuerPrefix starts the issuer of identities of client
+// certificates, followed by the distinguished name of the issuing CA.
+const ClientCertIssuerPrefix = "x509:"
+
+// ClientCertIdentity returns the issuer and subject of the identity of a user
+// authenticated by `cert`.
+func ClientCertIdentity(cert *x509.Certificate) (issuer string, subject string) {
+	return ClientCertIssuerPrefix + cert.Issuer.String(), cert.Subject.String()
+}
+
+// ErrUnknownClientCert is returned for client certificates without a linked user.
+var ErrUnknownClientCert = errors.New("client certificate is not linked to a user")
+
+// ClientCertStore maps verified client certificates to users through their
+// `db.ExternalIdentity`.
+type ClientCertStore struct {
+	db *gorm.DB
+}
+
+func NewClientCertStore(database *gorm.DB) *ClientCertStore {
+	return &ClientCertStore{db: database}
+}
+
+// Authenticate finds the user, that is neither in the trash nor disabled,
+// linked to the subject of `cert`.
+func (s *ClientCertStore) Authenticate(cert *x509.Certificate) (uint, error) {
+	issuer, subject := ClientCertIdentity(cert)
+	var identity db.ExternalIdentity
+	result := s.db.
+		Joins("JOIN users ON users.id = external_identities.user_id AND users.deleted_at IS NULL AND NOT users.disabled").
+		Where("external_identities.issuer = ? AND external_identities.subject = ?", issuer, subject).
+		Limit(1).Find(&identity)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrUnknownClientCert
+	}
+	return identity.UserID, nil
+}
+
+// verifiedClientCert returns the client certificate of the request, if the
+// server verified it against its client CAs.
+func verifiedClientCert(c *gin.Context) *x509.Certificate {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// ClientCertScopes are granted to requests authenticated by a client
+// certificate. Like API keys, certificates cannot manage the account.
+var ClientCertScopes = []string{
+	ScopeUsersRead,
+	ScopeAssetsRead,
+	ScopeAssetsWrite,
+	ScopeFavouritesRead,
+	ScopeFavouritesWrite,
+}
+
+// POST /admin/users/:id/certificates
+// AdminLinkClientCert lets the user authenticate with client certificates
+// with the distinguished names `Subject`, issued by the CA `Issuer`.
+func (uc *UserController) AdminLinkClientCert(c *gin.Context) {
+	var apiLink ClientCertLink
+	if err := c.ShouldBindJSON(&apiLink); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	dbUser, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	identity := db.ExternalIdentity{
+		UserID:  dbUser.ID,
+		Issuer:  ClientCertIssuerPrefix + apiLink.Issuer,
+		Subject: apiLink.Subject,
+	}
+	session := uc.GetSession(c)
+	result := session.Create(&identity)
+	if result.Error != nil && isUniqueViolation(result.Error) {
+		abortWithProblem(c, Conflict("Identity is already linked to a user."))
+		return
+	}
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusCreated, identity)
+}
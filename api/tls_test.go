@@ -0,0 +1,135 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+// newTestCert creates a self-signed certificate for `subject`
+func newTestCert(t *testing.T, subject pkix.Name) (*x509.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Equal(t, nil, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Equal(t, nil, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Equal(t, nil, err)
+	return cert,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	first, certPEM, keyPEM := newTestCert(t, pkix.Name{CommonName: "first"})
+	assert.Equal(t, nil, os.WriteFile(certFile, certPEM, 0o600))
+	assert.Equal(t, nil, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	assert.Equal(t, nil, err)
+	served, _ := reloader.GetCertificate(nil)
+	assert.Equal(t, first.Raw, served.Certificate[0])
+
+	// A half replaced pair keeps the current certificate
+	second, certPEM, keyPEM := newTestCert(t, pkix.Name{CommonName: "second"})
+	assert.Equal(t, nil, os.WriteFile(certFile, certPEM, 0o600))
+	later := time.Now().Add(time.Second)
+	assert.Equal(t, nil, os.Chtimes(certFile, later, later))
+	assert.NotEqual(t, nil, reloader.Reload())
+	served, _ = reloader.GetCertificate(nil)
+	assert.Equal(t, first.Raw, served.Certificate[0])
+
+	assert.Equal(t, nil, os.WriteFile(keyFile, keyPEM, 0o600))
+	assert.Equal(t, nil, os.Chtimes(keyFile, later, later))
+	assert.Equal(t, nil, reloader.Reload())
+	served, _ = reloader.GetCertificate(nil)
+	assert.Equal(t, second.Raw, served.Certificate[0])
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for host, location := range map[string]string{
+		"example.com":      "https://example.com:8443/api/v1/users?page=2",
+		"example.com:8080": "https://example.com:8443/api/v1/users?page=2",
+		"[::1]:8080":       "https://[::1]:8443/api/v1/users?page=2",
+	} {
+		req := httptest.NewRequest("GET", "http://"+host+"/api/v1/users?page=2", nil)
+		w := httptest.NewRecorder()
+		RedirectToHTTPS(8443).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, location, w.Header().Get("Location"))
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com:8080/", nil)
+	w := httptest.NewRecorder()
+	RedirectToHTTPS(443).ServeHTTP(w, req)
+	assert.Equal(t, "https://example.com/", w.Header().Get("Location"))
+}
+
+func performCertRequest(r http.Handler, method, path string, cert *x509.Certificate) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestClientCertAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	adminToken := createAdmin(t, database)
+	cert, _, _ := newTestCert(t, pkix.Name{CommonName: "robot", Organization: []string{"GWI"}})
+
+	w := performCertRequest(router, "GET", "/api/v1/assets", cert)
+	assert.Equal(t, 401, w.Code)
+
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/1/certificates", adminToken, jsonBody(t, gin.H{
+		"issuer":  cert.Issuer.String(),
+		"subject": cert.Subject.String(),
+	}))
+	assert.Equal(t, 201, w.Code)
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/2/certificates", adminToken, jsonBody(t, gin.H{
+		"issuer":  cert.Issuer.String(),
+		"subject": cert.Subject.String(),
+	}))
+	assert.Equal(t, 409, w.Code)
+
+	w = performCertRequest(router, "GET", "/api/v1/assets", cert)
+	assert.Equal(t, 200, w.Code)
+	// Certificates cannot manage the account
+	w = performCertRequest(router, "DELETE", "/api/v1/users/1", cert)
+	assert.Equal(t, 403, w.Code)
+
+	// Certificates of disabled users are refused
+	w = performAuthRequest(router, "POST", "/api/v1/admin/users/1/disable", adminToken, nil)
+	assert.Equal(t, 200, w.Code)
+	w = performCertRequest(router, "GET", "/api/v1/assets", cert)
+	assert.Equal(t, 401, w.Code)
+}
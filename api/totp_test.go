@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, truncated to 6 digits
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	code, err := TOTPCode(secret, TOTPStep(time.Unix(59, 0)))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, "287082", code)
+	code, err = TOTPCode(secret, TOTPStep(time.Unix(1111111109, 0)))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, "081804", code)
+
+	now := time.Unix(59, 0)
+	step, ok := ValidateTOTP(secret, "287082", now, 0)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, int64(1), step)
+	// Replay of the same step is refused
+	_, ok = ValidateTOTP(secret, "287082", now, step)
+	assert.Equal(t, false, ok)
+	_, ok = ValidateTOTP(secret, "000000", now, 0)
+	assert.Equal(t, false, ok)
+}
+
+func decodeBody(t *testing.T, body []byte) gin.H {
+	var got gin.H
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestTOTPLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	w := performAuthRequest(router, "POST", "/api/v1/users/1/totp", token, nil)
+	assert.Equal(t, 201, w.Code)
+	secret := decodeBody(t, w.Body.Bytes())["secret"].(string)
+	_, err = base32NoPadding.DecodeString(secret)
+	assert.Equal(t, err, nil)
+
+	// Not enabled until verified
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, nil, decodeBody(t, w.Body.Bytes())["mfa_required"])
+
+	w = performAuthRequest(router, "POST", "/api/v1/users/1/totp/verify", token, jsonBody(t, gin.H{"code": "000000"}))
+	assert.Equal(t, 401, w.Code)
+	// Use the previous step, so that the login below can use the current one
+	previous := TOTPStep(time.Now()) - 1
+	code, _ := TOTPCode(secret, previous)
+	w = performAuthRequest(router, "POST", "/api/v1/users/1/totp/verify", token, jsonBody(t, gin.H{"code": code}))
+	assert.Equal(t, 200, w.Code)
+	recoveryCodes := decodeBody(t, w.Body.Bytes())["recovery_codes"].([]interface{})
+	assert.Equal(t, RecoveryCodeCount, len(recoveryCodes))
+
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 200, w.Code)
+	got := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, true, got["mfa_required"])
+	assert.Equal(t, nil, got["token"])
+	mfaToken := got["mfa_token"].(string)
+
+	// The challenge token does not grant access
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", mfaToken, nil)
+	assert.Equal(t, 401, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/token/mfa", jsonBody(t, gin.H{"mfa_token": mfaToken, "code": code}))
+	assert.Equal(t, 401, w.Code)
+	code, _ = TOTPCode(secret, previous+1)
+	w = performRequest(router, "POST", "/api/v1/token/mfa", jsonBody(t, gin.H{"mfa_token": mfaToken, "code": code}))
+	assert.Equal(t, 200, w.Code)
+	accessToken := decodeBody(t, w.Body.Bytes())["token"].(string)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1", accessToken, nil)
+	assert.Equal(t, 200, w.Code)
+
+	// Challenge tokens are single use
+	w = performRequest(router, "POST", "/api/v1/token/mfa", jsonBody(t, gin.H{"mfa_token": mfaToken, "code": recoveryCodes[0]}))
+	assert.Equal(t, 401, w.Code)
+
+	// Recovery codes work once
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	mfaToken = decodeBody(t, w.Body.Bytes())["mfa_token"].(string)
+	w = performRequest(router, "POST", "/api/v1/token/mfa", jsonBody(t, gin.H{"mfa_token": mfaToken, "code": recoveryCodes[0]}))
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	mfaToken = decodeBody(t, w.Body.Bytes())["mfa_token"].(string)
+	w = performRequest(router, "POST", "/api/v1/token/mfa", jsonBody(t, gin.H{"mfa_token": mfaToken, "code": recoveryCodes[0]}))
+	assert.Equal(t, 401, w.Code)
+
+	w = performAuthRequest(router, "DELETE", "/api/v1/users/1/totp", accessToken, jsonBody(t, gin.H{"code": recoveryCodes[1]}))
+	assert.Equal(t, 204, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 200, w.Code)
+	assert.NotEqual(t, nil, decodeBody(t, w.Body.Bytes())["token"])
+}
+
+func TestRecoveryCodeFormat(t *testing.T) {
+	code, err := newRecoveryCode()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, 19, len(code))
+	assert.Equal(t, hashRecoveryCode(code), hashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))))
+}
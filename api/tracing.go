@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracerName identifies the spans of this package.
+const tracerName = "github.com/GlobalWebIndex/platform2.0-go-challenge/api"
+
+// Propagator reads the W3C "traceparent" and "tracestate" headers, so that
+// the spans of a request continue the trace of the caller.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// tracer returns the tracer of the global provider, which is a no-op until
+// one is set with `otel.SetTracerProvider`.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName, trace.WithInstrumentationVersion(Version))
+}
+
+// TracingMiddleware starts a server span for every request, named after the
+// route template, and passes it to the handlers in the request context.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := Propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		name := c.Request.Method + " " + route
+		if route == "" {
+			name = c.Request.Method
+		}
+		ctx, span := tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if userId := c.GetString("jwt_sub"); userId != "" {
+			span.SetAttributes(semconv.EnduserID(userId))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
+
+// traceAttrs returns the ids of the span in `ctx` for logs, if there is one.
+func traceAttrs(ctx context.Context) []slog.Attr {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []slog.Attr{
+		slog.String("trace_id", spanContext.TraceID().String()),
+		slog.String("span_id", spanContext.SpanID().String()),
+	}
+}
+
+// DBTracing is a gorm plugin creating a span per statement, as a child of
+// the span in the context of the session. Statements without a span in
+// their context, e.g. of background jobs, are not traced.
+type DBTracing struct{}
+
+func (DBTracing) Name() string {
+	return "tracing"
+}
+
+const dbTracingSpanKey = "tracing:span"
+
+// Initialize registers callbacks around every operation of gorm.
+func (DBTracing) Initialize(database *gorm.DB) error {
+	return registerAround(database, "tracing", func(operation string, tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := tracer().Start(ctx, operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemSqlite),
+		)
+		tx.InstanceSet(dbTracingSpanKey, span)
+	}, func(operation string, tx *gorm.DB) {
+		value, ok := tx.InstanceGet(dbTracingSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		defer span.End()
+		sql := sanitizeSQL(tx.Statement.SQL.String())
+		if keyword, _, _ := strings.Cut(sql, " "); keyword != "" {
+			operation = strings.ToUpper(keyword)
+		}
+		span.SetName(strings.TrimSpace(operation + " " + tx.Statement.Table))
+		span.SetAttributes(
+			semconv.DBOperation(operation),
+			semconv.DBSQLTable(tx.Statement.Table),
+			semconv.DBStatement(sql),
+		)
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, "statement failed")
+		}
+	})
+}
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// sanitizeSQL replaces the literals in `sql` with placeholders, so that
+// values written into statements, e.g. by `gorm.Expr`, are not exported.
+// Bound parameters are already placeholders.
+func sanitizeSQL(sql string) string {
+	sql = sqlStringLiteral.ReplaceAllString(sql, "?")
+	return sqlNumericLiteral.ReplaceAllString(sql, "?")
+}
+
+// TracingConfig selects where spans are exported.
+type TracingConfig struct {
+	// Exporter is "otlp" for an OTLP/HTTP collector or "stdout"
+	Exporter string
+	// Endpoint is the URL of the collector, by default the endpoint in
+	// $OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318
+	Endpoint    string
+	ServiceName string
+	// SampleRatio of the traces started here. Traces continued from a caller
+	// are sampled if the caller sampled them.
+	SampleRatio float64
+}
+
+// NewTracerProvider returns a provider exporting spans in batches as
+// configured. Shut it down to flush the remaining spans.
+func NewTracerProvider(ctx context.Context, config TracingConfig) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "otlp":
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown span exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	), nil
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans sets a global tracer provider recording the ended spans until
+// the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	spans := recordSpans(t)
+	logs := captureLogs(t)
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var server sdktrace.ReadOnlySpan
+	var queries []sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		switch span.SpanKind() {
+		case trace.SpanKindServer:
+			server = span
+		case trace.SpanKindClient:
+			queries = append(queries, span)
+		}
+	}
+	// The trace of the caller is continued
+	assert.Equal(t, "GET /api/v1/users/:id", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, int64(200), spanAttribute(server, "http.response.status_code").AsInt64())
+	assert.Equal(t, "1", spanAttribute(server, "enduser.id").AsString())
+
+	assert.NotEqual(t, 0, len(queries))
+	for _, query := range queries {
+		assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+		assert.Equal(t, "sqlite", spanAttribute(query, "db.system").AsString())
+		assert.Equal(t, true, strings.HasPrefix(query.Name(), "SELECT "))
+	}
+
+	entry := decodeLogLines(t, logs)[0]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+	assert.Equal(t, server.SpanContext().SpanID().String(), entry["span_id"])
+}
+
+func TestTracingWithoutCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := CreateTestEngine(initDB(), true)
+	spans := recordSpans(t)
+
+	w := performRequest(router, "GET", "/nowhere", nil)
+	assert.Equal(t, 404, w.Code)
+	ended := spans.Ended()
+	assert.Equal(t, 1, len(ended))
+	assert.Equal(t, "GET", ended[0].Name())
+	assert.Equal(t, false, ended[0].Parent().IsValid())
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	assert.Equal(t,
+		"SELECT * FROM `users` WHERE username = ? AND `users`.`id` = ? AND v2 = ? LIMIT ?",
+		sanitizeSQL("SELECT * FROM `users` WHERE username = 'o''brien' AND `users`.`id` = ? AND v2 = 1.5 LIMIT 1"))
+}
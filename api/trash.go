@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// TrashedAsset is an Asset in the trash, with the time it gets purged.
+type TrashedAsset struct {
+	db.Asset
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// AssetInTrash creates a 409 problem for changes of an asset in the trash,
+// which has to be restored first.
+func AssetInTrash() *Problem {
+	return &Problem{
+		Type:   ProblemTypeConflict,
+		Title:  "Asset is in the trash.",
+		Status: http.StatusConflict,
+		Detail: "Restore the asset with POST /trash/assets/{id}/restore before changing it.",
+	}
+}
+
+// GET /trash/assets
+func (ac *AssetController) GetTrashedAssets(c *gin.Context) {
+	var dbAssets []db.Asset
+
+	session := ac.GetSession(c)
+	result := session.Unscoped().Where("deleted_at IS NOT NULL").Preload(clause.Associations).Preload("Audience.Characteristics").Find(&dbAssets)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithProblem(c, NotFound())
+		return
+	}
+	trashed := make([]TrashedAsset, len(dbAssets))
+	for i, dbAsset := range dbAssets {
+		trashed[i] = TrashedAsset{
+			Asset:     dbAsset,
+			DeletedAt: dbAsset.DeletedAt.Time,
+			PurgeAt:   db.PurgeAt(dbAsset.DeletedAt),
+		}
+	}
+	c.PureJSON(http.StatusOK, trashed)
+}
+
+// POST /trash/assets/:id/restore
+// RestoreAssetByID moves an Asset out of the trash, which also brings back
+// all of the favourites that reference it.
+func (ac *AssetController) RestoreAssetByID(c *gin.Context) {
+	id := c.Param("id")
+	assetId, _ := strconv.Atoi(id)
+
+	session := ac.GetSession(c)
+	result := session.Unscoped().Model(&db.Asset{}).Where("id = ? AND deleted_at IS NOT NULL", assetId).Update("deleted_at", nil)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithProblem(c, NotFound())
+		return
+	}
+
+	dbAsset := db.Asset{ID: uint(assetId)}
+	result = session.Preload(clause.Associations).Preload("Audience.Characteristics").Find(&dbAsset)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusOK, dbAsset)
+}
+
+// POST /users/restore
+// RestoreUser moves a User out of the trash. Deleted users cannot obtain a
+// token, so the request is authenticated with the user's credentials instead.
+func (uc *UserController) RestoreUser(c *gin.Context) {
+	var credentials Credentials
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		abortWithProblem(c, InvalidInput(c, err))
+		return
+	}
+	if retryAfter := uc.limiter.RetryAfter(credentials.Username, c.ClientIP()); retryAfter > 0 {
+		abortTooManyRequests(c, retryAfter)
+		return
+	}
+
+	var dbUser db.User
+	session := uc.GetSession(c)
+	result := session.Unscoped().Where("username = ? AND deleted_at IS NOT NULL", credentials.Username).Limit(1).Find(&dbUser)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 || dbUser.CheckPassword(credentials.Password) != nil {
+		uc.limiter.Failure(credentials.Username, c.ClientIP())
+		abortWithProblem(c, Unauthorized("Invalid credentials."))
+		return
+	}
+	uc.limiter.Success(credentials.Username)
+
+	result = session.Unscoped().Model(&dbUser).Update("deleted_at", nil)
+	if result.Error != nil {
+		abortWithProblem(c, DBProblem(result.Error))
+		return
+	}
+	c.PureJSON(http.StatusOK, dbUser)
+}
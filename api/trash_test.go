@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestAssetTrash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+
+	// Favourite the chart asset
+	data, err := json.Marshal(gin.H{"id": 1})
+	assert.Equal(t, err, nil)
+	w := performAuthRequest(router, "POST", "/api/v1/users/1/favourites", token, io.NopCloser(bytes.NewBuffer(data)))
+	assert.Equal(t, 201, w.Code)
+
+	w = performAuthRequest(router, "GET", "/api/v1/trash/assets", token, nil)
+	assert.Equal(t, 404, w.Code)
+
+	w = performAuthRequest(router, "DELETE", "/api/v1/assets/1", token, nil)
+	assert.Equal(t, 204, w.Code)
+
+	// Asset and the favourite are hidden
+	w = performAuthRequest(router, "GET", "/api/v1/assets/1", token, nil)
+	assert.Equal(t, 404, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1/favourites/1", token, nil)
+	assert.Equal(t, 404, w.Code)
+	// Trashed and missing assets cannot be favourited, nor replaced
+	w = performAuthRequest(router, "POST", "/api/v1/users/1/favourites", token, jsonBody(t, gin.H{"id": 1}))
+	assert.Equal(t, 404, w.Code)
+	w = performAuthRequest(router, "POST", "/api/v1/users/1/favourites", token, jsonBody(t, gin.H{"id": 42}))
+	assert.Equal(t, 404, w.Code)
+	w = performAuthRequest(router, "PUT", "/api/v1/assets/1", token, jsonBody(t, gin.H{"insight": gin.H{"description": "d"}}))
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, "Asset is in the trash.", decodeBody(t, w.Body.Bytes())["title"])
+
+	w = performAuthRequest(router, "GET", "/api/v1/trash/assets", token, nil)
+	assert.Equal(t, 200, w.Code)
+	var got []TrashedAsset
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, uint(1), got[0].ID)
+	assert.Equal(t, "test", got[0].Chart.Title)
+	assert.Equal(t, db.TrashRetention, got[0].PurgeAt.Sub(got[0].DeletedAt))
+
+	// Restoring brings back the favourite
+	w = performAuthRequest(router, "POST", "/api/v1/trash/assets/1/restore", token, nil)
+	assert.Equal(t, 200, w.Code)
+	w = performAuthRequest(router, "POST", "/api/v1/trash/assets/1/restore", token, nil)
+	assert.Equal(t, 404, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/users/1/favourites/1", token, nil)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestRestoreUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, err, nil)
+	w := performAuthRequest(router, "DELETE", "/api/v1/users/1", token, nil)
+	assert.Equal(t, 204, w.Code)
+
+	credentials, err := json.Marshal(gin.H{"username": "test", "password": "testpass1"})
+	assert.Equal(t, err, nil)
+	w = performRequest(router, "POST", "/api/v1/token", io.NopCloser(bytes.NewBuffer(credentials)))
+	assert.Equal(t, 401, w.Code)
+
+	wrong, err := json.Marshal(gin.H{"username": "test", "password": "wrong"})
+	assert.Equal(t, err, nil)
+	w = performRequest(router, "POST", "/api/v1/users/restore", io.NopCloser(bytes.NewBuffer(wrong)))
+	assert.Equal(t, 401, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/users/restore", io.NopCloser(bytes.NewBuffer(credentials)))
+	assert.Equal(t, 200, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", io.NopCloser(bytes.NewBuffer(credentials)))
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	database := initDB()
+	db.FillDB(database)
+	user := db.User{ID: 1}
+	err := database.Model(&user).Association("Favourites").Append(&db.Asset{ID: 1})
+	assert.Equal(t, err, nil)
+
+	database.Delete(&db.Asset{ID: 1})
+	database.Delete(&db.Asset{ID: 3})
+	database.Delete(&db.User{ID: 1})
+
+	// Nothing has expired yet
+	users, assets, err := db.PurgeDeleted(database)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, int64(0), users)
+	assert.Equal(t, int64(0), assets)
+
+	database.Unscoped().Model(&db.Asset{}).Where("id IN ?", []uint{1, 3}).
+		Update("deleted_at", time.Now().Add(-db.TrashRetention-time.Minute))
+	users, assets, err = db.PurgeDeleted(database)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, int64(0), users)
+	assert.Equal(t, int64(2), assets)
+
+	var count int64
+	database.Unscoped().Model(&db.Asset{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	database.Model(&db.Chart{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.Model(&db.Audience{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.Table("audience_characteristics").Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.Table("user_assets").Count(&count)
+	assert.Equal(t, int64(0), count)
+	// The user is still within the retention period
+	database.Unscoped().Model(&db.User{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
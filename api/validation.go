@@ -0,0 +1,217 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+)
+
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{2,31}$`)
+
+// localeRegex matches BCP 47 language tags such as "en", "fr-CA" or "zh-Hant-TW"
+var localeRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+var (
+	translator   *ut.UniversalTranslator
+	validateOnce sync.Once
+)
+
+// customTranslations holds messages of the rules registered by `registerValidations`.
+var customTranslations = map[string]map[string]string{
+	"en": {
+		"username":   "{0} must be 3 to 32 characters long and contain only letters, digits, '.', '_' or '-'",
+		"password":   "{0} must be at least {1} characters long and contain a letter and a digit or symbol",
+		"base64":     "{0} must be a valid base64 string",
+		"unbreached": "{0} has appeared in a data breach and cannot be used",
+		"scope":      "{0} must be a known scope",
+		"locale":     "{0} must be a language tag such as 'en' or 'fr-CA'",
+		"tz":         "{0} must be a time zone such as 'Europe/London'",
+		"avatar":     "{0} must be an http or https URL",
+	},
+	"fr": {
+		"username":   "{0} doit faire entre 3 et 32 caractères et ne contenir que des lettres, des chiffres, '.', '_' ou '-'",
+		"password":   "{0} doit faire au moins {1} caractères et contenir une lettre et un chiffre ou un symbole",
+		"base64":     "{0} doit être une chaîne base64 valide",
+		"unbreached": "{0} a été divulgué lors d'une fuite de données et ne peut pas être utilisé",
+		"scope":      "{0} doit être un scope connu",
+		"locale":     "{0} doit être une étiquette de langue comme 'en' ou 'fr-CA'",
+		"tz":         "{0} doit être un fuseau horaire comme 'Europe/Paris'",
+		"avatar":     "{0} doit être une URL http ou https",
+	},
+}
+
+// registerValidations configures the gin validator to report json field names,
+// adds the custom "username", "password", "unbreached", "scope", "locale", "tz"
+// and "avatar" rules and loads the translations of validation messages.
+// Safe to call multiple times.
+func registerValidations() {
+	validateOnce.Do(func() {
+		validate, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			panic("unsupported gin validator engine")
+		}
+		validate.RegisterTagNameFunc(jsonFieldName)
+		validate.RegisterValidation("username", isUsername)
+		validate.RegisterValidation("password", isStrongPassword)
+		validate.RegisterValidation("unbreached", isUnbreachedPassword)
+		validate.RegisterValidation("scope", isScope)
+		validate.RegisterValidation("locale", isLocale)
+		validate.RegisterValidation("tz", isTimezone)
+		validate.RegisterValidation("avatar", isAvatarURL)
+
+		english := en.New()
+		translator = ut.New(english, english, fr.New())
+		registerTranslations(validate, "en", en_translations.RegisterDefaultTranslations)
+		registerTranslations(validate, "fr", fr_translations.RegisterDefaultTranslations)
+	})
+}
+
+func registerTranslations(validate *validator.Validate, locale string, registerDefaults func(*validator.Validate, ut.Translator) error) {
+	trans, _ := translator.GetTranslator(locale)
+	if err := registerDefaults(validate, trans); err != nil {
+		panic(err)
+	}
+	for tag, message := range customTranslations[locale] {
+		message := message
+		err := validate.RegisterTranslation(
+			tag,
+			trans,
+			func(trans ut.Translator) error {
+				return trans.Add(tag, message, true)
+			},
+			func(trans ut.Translator, fe validator.FieldError) string {
+				param := fe.Param()
+				if fe.Tag() == "password" {
+					param = strconv.Itoa(db.Policy.MinLength)
+				}
+				translated, err := trans.T(fe.Tag(), fe.Field(), param)
+				if err != nil {
+					return fe.Error()
+				}
+				return translated
+			},
+		)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// jsonFieldName names struct fields after their json key in validation errors.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func isUsername(fl validator.FieldLevel) bool {
+	return usernameRegex.MatchString(fl.Field().String())
+}
+
+// isStrongPassword checks length and composition required by `db.Policy`.
+func isStrongPassword(fl validator.FieldLevel) bool {
+	return db.Policy.CheckStrength(fl.Field().String()) == nil
+}
+
+// isUnbreachedPassword checks the breached password list of `db.Policy`.
+func isUnbreachedPassword(fl validator.FieldLevel) bool {
+	return !db.Policy.IsBreached(fl.Field().String())
+}
+
+// Profile rules accept empty values, which clear the field
+
+func isLocale(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	return value == "" || localeRegex.MatchString(value)
+}
+
+// isTimezone checks for a name of the IANA time zone database.
+func isTimezone(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value == "" {
+		return true
+	}
+	// "Local" would be the time zone of the server
+	if strings.EqualFold(value, "local") {
+		return false
+	}
+	_, err := time.LoadLocation(value)
+	return err == nil
+}
+
+func isAvatarURL(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value == "" {
+		return true
+	}
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// requestTranslator picks the translator for the "Accept-Language" header of `c`,
+// falling back to english.
+func requestTranslator(c *gin.Context) ut.Translator {
+	registerValidations()
+	var locales []string
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		locale := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		locales = append(locales, strings.ReplaceAll(locale, "-", "_"))
+		// Fall back from region to language, e.g. "fr_CA" to "fr"
+		if language := strings.SplitN(locale, "-", 2)[0]; language != locale {
+			locales = append(locales, language)
+		}
+	}
+	trans, _ := translator.FindTranslator(locales...)
+	return trans
+}
+
+// jsonPointer converts validator namespace such as "Asset.audience.characteristics[0].gender"
+// into a JSON pointer to the field in the request body, "/audience/characteristics/0/gender".
+func jsonPointer(namespace string) string {
+	segments := strings.Split(namespace, ".")[1:]
+	var pointer strings.Builder
+	for _, segment := range segments {
+		for segment != "" {
+			name := segment
+			index := ""
+			if open := strings.Index(segment, "["); open >= 0 {
+				end := strings.Index(segment, "]")
+				name = segment[:open]
+				index = segment[open+1 : end]
+				segment = segment[end+1:]
+			} else {
+				segment = ""
+			}
+			if name != "" {
+				name = strings.ReplaceAll(name, "~", "~0")
+				pointer.WriteString("/" + strings.ReplaceAll(name, "/", "~1"))
+			}
+			if index != "" {
+				pointer.WriteString("/" + index)
+			}
+		}
+	}
+	return pointer.String()
+}
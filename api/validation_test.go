@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func performLocalizedRequest(r http.Handler, method, path, language string, payload gin.H) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(payload)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Accept-Language", language)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestJSONPointer(t *testing.T) {
+	assert.Equal(t, "/password", jsonPointer("User.password"))
+	assert.Equal(t, "/chart/title", jsonPointer("Asset.chart.title"))
+	assert.Equal(t, "/audience/characteristics/1/gender", jsonPointer("Asset.audience.characteristics[1].gender"))
+}
+
+func TestAssetValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	router := CreateTestEngine(database, false)
+
+	w := performLocalizedRequest(router, "POST", "/api/v1/assets", "en", gin.H{
+		"chart": gin.H{"title": strings.Repeat("a", 257)},
+		"audience": gin.H{"characteristics": []gin.H{
+			{"gender": "F"},
+			{"gender": "Male"},
+		}},
+	})
+	assert.Equal(t, 400, w.Code)
+
+	problem := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, 2, len(problem.Errors))
+	assert.Equal(t, FieldError{
+		Pointer: "/chart/title",
+		Rule:    "max",
+		Message: "title must be a maximum of 256 characters in length",
+	}, problem.Errors[0])
+	assert.Equal(t, "/audience/characteristics/1/gender", problem.Errors[1].Pointer)
+	assert.Equal(t, "len", problem.Errors[1].Rule)
+}
+
+func TestUserValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	router := CreateTestEngine(database, false)
+
+	w := performLocalizedRequest(router, "POST", "/api/v1/users", "fr-CA, en;q=0.5", gin.H{
+		"username": "a b",
+		"password": "password",
+	})
+	assert.Equal(t, 400, w.Code)
+
+	problem := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, 2, len(problem.Errors))
+	assert.Equal(t, "/username", problem.Errors[0].Pointer)
+	assert.Equal(t, "username", problem.Errors[0].Rule)
+	assert.Equal(t, "/password", problem.Errors[1].Pointer)
+	assert.Equal(t, "password", problem.Errors[1].Rule)
+	assert.Equal(t,
+		"password doit faire au moins 8 caractères et contenir une lettre et un chiffre ou un symbole",
+		problem.Errors[1].Message,
+	)
+
+	// Login is not subject to the registration rules
+	w = performLocalizedRequest(router, "POST", "/api/v1/token", "en", gin.H{
+		"username": "a b",
+		"password": "password",
+	})
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestPasswordMaxLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database := initDB()
+	db.FillDB(database)
+	router := CreateTestEngine(database, true)
+
+	// bcrypt refuses passwords longer than 72 bytes
+	for password, rule := range map[string]string{
+		strings.Repeat("password", 9) + "1234": "max",
+		strings.Repeat("€", 24) + "pw1":        "password",
+	} {
+		w := performLocalizedRequest(router, "POST", "/api/v1/users", "en", gin.H{
+			"username": "long",
+			"password": password,
+		})
+		assert.Equal(t, 400, w.Code)
+		problem := decodeProblem(t, w.Body.Bytes())
+		assert.Equal(t, 1, len(problem.Errors))
+		assert.Equal(t, "/password", problem.Errors[0].Pointer)
+		assert.Equal(t, rule, problem.Errors[0].Rule)
+	}
+
+	token, err := GenerateJWT(1)
+	assert.Equal(t, nil, err)
+	w := performAuthRequest(router, "PUT", "/api/v1/users/1/password", token, jsonBody(t, gin.H{
+		"old_password": "testpass1",
+		"new_password": strings.Repeat("password", 9) + "1234",
+	}))
+	assert.Equal(t, 400, w.Code)
+	w = performRequest(router, "POST", "/api/v1/token", jsonBody(t, gin.H{"username": "test", "password": "testpass1"}))
+	assert.Equal(t, 200, w.Code)
+
+	user := db.User{}
+	assert.NotEqual(t, nil, user.SetPassword(strings.Repeat("password", 9)+"1234"))
+	assert.Equal(t, "", user.PasswordHash)
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// AdminUserIterator pages through the users found by `Client.AdminUsers`:
+//
+//	users := c.AdminUsers("", 0)
+//	for users.Next(ctx) {
+//		fmt.Println(users.User().Username)
+//	}
+//	if err := users.Err(); err != nil {
+//		...
+//	}
+type AdminUserIterator struct {
+	client   *Client
+	query    string
+	pageSize int
+
+	page  int
+	users []AdminUser
+	index int
+	done  bool
+	err   error
+}
+
+// AdminUsers iterates over the users with `query` in their name, or over all
+// users if it is empty. Pages of `pageSize` users are requested as needed,
+// the page size of the API is used if it is 0. Requires the admin role.
+func (c *Client) AdminUsers(query string, pageSize int) *AdminUserIterator {
+	return &AdminUserIterator{client: c, query: query, pageSize: pageSize, index: -1}
+}
+
+// Next advances to the next user, and reports whether there is one. The next
+// page is requested after the last user of a page.
+func (it *AdminUserIterator) Next(ctx context.Context) bool {
+	if it.index+1 < len(it.users) {
+		it.index++
+		return true
+	}
+	if it.done || it.err != nil {
+		return false
+	}
+	page, err := it.fetch(ctx, it.page+1)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.page = page.Page
+	it.users = page.Users
+	it.index = 0
+	it.done = page.Page*page.PageSize >= page.Total
+	return len(it.users) > 0
+}
+
+// User returns the current user, after `Next` reported one.
+func (it *AdminUserIterator) User() AdminUser {
+	return it.users[it.index]
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *AdminUserIterator) Err() error {
+	return it.err
+}
+
+func (it *AdminUserIterator) fetch(ctx context.Context, page int) (*adminUserPage, error) {
+	query := url.Values{"page": {strconv.Itoa(page)}}
+	if it.pageSize > 0 {
+		query.Set("page_size", strconv.Itoa(it.pageSize))
+	}
+	if it.query != "" {
+		query.Set("q", it.query)
+	}
+	var result adminUserPage
+	err := it.client.do(ctx, http.MethodGet, "/api/v1/admin/users?"+query.Encode(), false, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
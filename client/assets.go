@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ListAssets returns all assets.
+func (c *Client) ListAssets(ctx context.Context) ([]Asset, error) {
+	var assets []Asset
+	return assets, c.list(ctx, "/api/v1/assets", &assets)
+}
+
+// CreateAsset creates a new asset and returns it with its id.
+func (c *Client) CreateAsset(ctx context.Context, asset Asset) (*Asset, error) {
+	return c.sendAsset(ctx, http.MethodPost, "/api/v1/assets", asset)
+}
+
+// GetAsset returns the asset `id`.
+func (c *Client) GetAsset(ctx context.Context, id uint) (*Asset, error) {
+	var asset Asset
+	if err := c.do(ctx, http.MethodGet, assetPath(id), false, nil, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// ReplaceAsset replaces the asset `id`, or creates it with this id.
+func (c *Client) ReplaceAsset(ctx context.Context, id uint, asset Asset) (*Asset, error) {
+	return c.sendAsset(ctx, http.MethodPut, assetPath(id), asset)
+}
+
+// UpdateAsset changes the parts of the asset `id` that are set in `asset`.
+func (c *Client) UpdateAsset(ctx context.Context, id uint, asset Asset) (*Asset, error) {
+	return c.sendAsset(ctx, http.MethodPatch, assetPath(id), asset)
+}
+
+// DeleteAsset moves the asset `id` to the trash.
+func (c *Client) DeleteAsset(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, assetPath(id), false, nil, nil)
+}
+
+func (c *Client) sendAsset(ctx context.Context, method, path string, asset Asset) (*Asset, error) {
+	// The id is read-only
+	asset.ID = 0
+	var result Asset
+	if err := c.do(ctx, method, path, false, asset, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func assetPath(id uint) string {
+	return fmt.Sprintf("/api/v1/assets/%d", id)
+}
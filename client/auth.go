@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrMFARequired is returned by logins of users with two-factor
+// authentication if `Client.TOTP` is not set.
+var ErrMFARequired = errors.New("two-factor authentication required, set Client.TOTP")
+
+// ErrNoCredentials is returned when a token is needed but the client has no
+// username, e.g. after a token set with `SetToken` expired.
+var ErrNoCredentials = errors.New("client has neither credentials nor a valid token")
+
+// tokenLeeway renews tokens shortly before they expire, so that they do not
+// expire in flight.
+const tokenLeeway = 30 * time.Second
+
+// Token is an access token of a user.
+type Token struct {
+	// UserID is the id of the user the token was issued to
+	UserID    uint    `json:"id"`
+	Token     string  `json:"token"`
+	TokenType string  `json:"token_type"`
+	ExpiresIn float64 `json:"expires_in"`
+	// Scope lists the granted scopes separated by spaces
+	Scope string `json:"scope"`
+}
+
+// tokenResponse is either a token or a two-factor challenge.
+type tokenResponse struct {
+	Token
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// Login acquires a new access token with `Username` and `Password`. Other
+// operations log in when needed, so calling it is only required to learn the
+// id of the user.
+func (c *Client) Login(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.login(ctx)
+}
+
+// login must be called with `mu` held.
+func (c *Client) login(ctx context.Context) (*Token, error) {
+	if c.Username == "" {
+		return nil, ErrNoCredentials
+	}
+	var response tokenResponse
+	request := map[string]any{"username": c.Username, "password": c.Password}
+	if len(c.Scopes) > 0 {
+		request["scopes"] = c.Scopes
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/token", true, request, &response); err != nil {
+		return nil, err
+	}
+	if response.MFARequired {
+		if c.TOTP == nil {
+			return nil, ErrMFARequired
+		}
+		code, err := c.TOTP(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("TOTP code: %w", err)
+		}
+		request := map[string]string{"mfa_token": response.MFAToken, "code": code}
+		if err := c.do(ctx, http.MethodPost, "/api/v1/token/mfa", true, request, &response.Token); err != nil {
+			return nil, err
+		}
+	}
+	c.useToken(&response.Token)
+	return &response.Token, nil
+}
+
+// useToken must be called with `mu` held.
+func (c *Client) useToken(token *Token) {
+	c.token = token.Token
+	c.expiry = time.Now().Add(time.Duration(token.ExpiresIn * float64(time.Second)))
+}
+
+// SetToken uses `token` until shortly before `expiresAt`, e.g. a token stored
+// by an earlier process. The client logs in again afterwards if it has
+// credentials.
+func (c *Client) SetToken(token string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.expiry = expiresAt
+}
+
+// CurrentToken returns the token in use and its expiry, or "" before the
+// first login.
+func (c *Client) CurrentToken() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.expiry
+}
+
+// authorize sets the API key or a valid token on `request`. Returns the token.
+func (c *Client) authorize(ctx context.Context, request *http.Request) (string, error) {
+	if c.APIKey != "" {
+		request.Header.Set("X-API-Key", c.APIKey)
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" || time.Now().Add(tokenLeeway).After(c.expiry) {
+		if _, err := c.login(ctx); err != nil {
+			return "", err
+		}
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	return c.token, nil
+}
+
+// dropToken forgets `token` after it was rejected, unless another request
+// already replaced it.
+func (c *Client) dropToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// Logout revokes the current token. The next operation logs in again.
+func (c *Client) Logout(ctx context.Context) error {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	if token == "" {
+		return nil
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/logout", false, nil, nil)
+	c.dropToken(token)
+	return err
+}
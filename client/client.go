@@ -0,0 +1,245 @@
+// Package client is a typed Go client of the API described in
+// api/openapi.yaml, for services calling it instead of hand-written requests.
+//
+// A `Client` logs in with a username and password and logs in again when the
+// token expires or is revoked, or it sends an API key. Requests that failed
+// temporarily are retried with exponential backoff, see `RetryPolicy`.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls the API at `BaseURL`. Its fields must not be changed while
+// requests are in flight.
+type Client struct {
+	// BaseURL is the root of the API, e.g. "https://api.example.com"
+	BaseURL    string
+	HTTPClient *http.Client
+	// Username and Password acquire access tokens
+	Username string
+	Password string
+	// Scopes requested for the tokens, all scopes of the user if empty
+	Scopes []string
+	// TOTP returns the current code of users with two-factor authentication
+	TOTP func(ctx context.Context) (string, error)
+	// APIKey is sent instead of a token if set
+	APIKey string
+	Retry  RetryPolicy
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// RetryPolicy says how often and how long apart failed requests are retried.
+// Requests are retried after network errors and 502, 503 and 504 responses if
+// they are idempotent, and after 429 responses if "Retry-After" is within
+// `MaxBackoff`.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, 1 turns retries off
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  200 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// New returns a client of the API at `baseURL` with the default retry policy.
+// Set `Username` and `Password` or `APIKey` before calling protected
+// operations.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Retry:      DefaultRetryPolicy,
+	}
+}
+
+// Error is a problem returned by the API, see api.Problem.
+type Error struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	// RetryAfter is set from the "Retry-After" header of 429 responses
+	RetryAfter time.Duration `json:"-"`
+}
+
+// FieldError is an invalid field of the request body.
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%d %s %s", e.Status, e.Title, e.Detail)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Title)
+}
+
+// IsStatus reports whether `err` is an `Error` with the HTTP `status`.
+func IsStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// do sends the JSON of `body` if it is not nil and decodes the response into
+// `out` if it is not nil. Responses with an error status are returned as
+// `*Error`. The request is authorized unless `public` is set.
+func (c *Client) do(ctx context.Context, method, path string, public bool, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	response, err := c.send(ctx, method, path, public, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return decodeError(response)
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		_, err = io.Copy(io.Discard, response.Body)
+		return err
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// send retries the request according to `Retry`. A token rejected with 401
+// is dropped and the request sent once more with a new one.
+func (c *Client) send(ctx context.Context, method, path string, public bool, data []byte) (*http.Response, error) {
+	reauthorized := false
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			request.Body = io.NopCloser(bytes.NewReader(data))
+			request.ContentLength = int64(len(data))
+			request.Header.Set("Content-Type", "application/json")
+		}
+		request.Header.Set("Accept", "application/json")
+		var token string
+		if !public {
+			if token, err = c.authorize(ctx, request); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := c.HTTPClient.Do(request)
+		if err != nil {
+			if !idempotent(method) || !c.wait(ctx, attempt, 0) {
+				return nil, err
+			}
+			continue
+		}
+		if response.StatusCode == http.StatusUnauthorized && token != "" && !reauthorized {
+			drain(response)
+			c.dropToken(token)
+			reauthorized = true
+			attempt--
+			continue
+		}
+		if retryable(method, response.StatusCode) && c.wait(ctx, attempt, retryAfter(response)) {
+			drain(response)
+			continue
+		}
+		return response, nil
+	}
+}
+
+// wait sleeps before the next attempt and reports whether there is one.
+// A `delay` requested by the server is used instead of the backoff.
+func (c *Client) wait(ctx context.Context, attempt int, delay time.Duration) bool {
+	if attempt >= c.Retry.MaxAttempts || delay > c.Retry.MaxBackoff {
+		return false
+	}
+	if delay == 0 {
+		delay = c.Retry.backoff(attempt)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// backoff doubles the delay with each attempt, with jitter so that clients
+// do not retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MinBackoff << (attempt - 1)
+	if delay > p.MaxBackoff || delay <= 0 {
+		delay = p.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether a response with `status` may succeed later.
+// Requests refused with 429 were not processed, so any method is retried.
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+func retryAfter(response *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func decodeError(response *http.Response) error {
+	apiErr := &Error{Status: response.StatusCode, Title: http.StatusText(response.StatusCode)}
+	// Errors of proxies are not problems, the status is enough then
+	_ = json.NewDecoder(response.Body).Decode(apiErr)
+	apiErr.RetryAfter = retryAfter(response)
+	return apiErr
+}
+
+// drain lets the connection of a discarded response be reused.
+func drain(response *http.Response) {
+	_, _ = io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+}
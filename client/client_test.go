@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/api"
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newServer serves the API with the fixtures of `db.FillDB`, checking the
+// requests and responses against the OpenAPI document. Logins are counted in
+// `logins`.
+func newServer(t *testing.T) (*httptest.Server, *gorm.DB, *int32) {
+	gin.SetMode(gin.TestMode)
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Migrate(database)
+	db.FillDB(database)
+	engine := api.CreateTestEngine(database, true)
+
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/token" {
+			atomic.AddInt32(&logins, 1)
+		}
+		engine.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, database, &logins
+}
+
+func newClient(baseURL string) *Client {
+	c := New(baseURL)
+	c.Username = "test"
+	c.Password = "testpass1"
+	c.Retry.MinBackoff = time.Millisecond
+	c.Retry.MaxBackoff = 10 * time.Millisecond
+	return c
+}
+
+func TestUsersAndFavourites(t *testing.T) {
+	server, _, _ := newServer(t)
+	ctx := context.Background()
+	c := newClient(server.URL)
+
+	created, err := New(server.URL).CreateUser(ctx, "other", "otherpass1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "other", created.Username)
+	_, err = New(server.URL).CreateUser(ctx, "other", "otherpass1")
+	assert.Equal(t, true, IsStatus(err, http.StatusConflict))
+
+	token, err := c.Login(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint(1), token.UserID)
+	users, err := c.ListUsers(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(users))
+
+	name := "Tess"
+	user, err := c.UpdateProfile(ctx, token.UserID, ProfileUpdate{DisplayName: &name})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Tess", user.DisplayName)
+	user, err = c.GetUser(ctx, token.UserID)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Tess", user.DisplayName)
+	assert.Equal(t, "test", user.Username)
+
+	favourites, err := c.ListFavourites(ctx, token.UserID)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(favourites))
+	_, err = c.AddFavourite(ctx, token.UserID, 2)
+	assert.Equal(t, nil, err)
+	favourite, err := c.GetFavourite(ctx, token.UserID, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint(2), favourite.ID)
+	favourites, err = c.ListFavourites(ctx, token.UserID)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(favourites))
+	assert.Equal(t, nil, c.RemoveFavourite(ctx, token.UserID, 2))
+	_, err = c.GetFavourite(ctx, token.UserID, 2)
+	assert.Equal(t, true, IsStatus(err, http.StatusNotFound))
+
+	// Only the user itself
+	_, err = c.ListFavourites(ctx, created.ID)
+	assert.Equal(t, true, IsStatus(err, http.StatusForbidden))
+}
+
+func TestAssets(t *testing.T) {
+	server, _, _ := newServer(t)
+	ctx := context.Background()
+	c := newClient(server.URL)
+
+	asset, err := c.CreateAsset(ctx, Asset{Insight: &Insight{Description: "40% of millenials"}})
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, uint(0), asset.ID)
+	asset, err = c.UpdateAsset(ctx, asset.ID, Asset{Insight: &Insight{Description: "45% of millenials"}})
+	assert.Equal(t, nil, err)
+	asset, err = c.GetAsset(ctx, asset.ID)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "45% of millenials", asset.Insight.Description)
+	assets, err := c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, 0, len(assets))
+
+	assert.Equal(t, nil, c.DeleteAsset(ctx, asset.ID))
+	_, err = c.GetAsset(ctx, asset.ID)
+	assert.Equal(t, true, IsStatus(err, http.StatusNotFound))
+
+	_, err = c.CreateAsset(ctx, Asset{Audience: &Audience{Characteristics: []Characteristic{{Gender: "Male"}}}})
+	apiErr, ok := err.(*Error)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, "/audience/characteristics/0/gender", apiErr.Errors[0].Pointer)
+}
+
+func TestTokenRenewal(t *testing.T) {
+	server, _, logins := newServer(t)
+	ctx := context.Background()
+	c := newClient(server.URL)
+
+	_, err := c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(logins))
+
+	// Expired tokens are renewed before requests
+	c.expiry = time.Now().Add(-time.Second)
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(logins))
+
+	// Revoked tokens are renewed after the rejection
+	assert.Equal(t, nil, c.Logout(ctx))
+	c.token = "revoked"
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(logins))
+
+	// The new password is used after the change
+	assert.Equal(t, nil, c.ChangePassword(ctx, 1, "testpass1", "n3w-passphrase"))
+	assert.Equal(t, "n3w-passphrase", c.Password)
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	c.expiry = time.Now().Add(-time.Second)
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+
+	c.Password = "wrong"
+	c.expiry = time.Now().Add(-time.Second)
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, true, IsStatus(err, http.StatusUnauthorized))
+}
+
+func TestRetries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch n := atomic.AddInt32(&attempts, 1); {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case n == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case n == 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `[{"id": 1}]`)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	c := newClient(server.URL)
+	c.APIKey = "gwi_test"
+
+	assets, err := c.ListAssets(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []Asset{{ID: 1}}, assets)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// Requests that are not idempotent may have been processed
+	atomic.StoreInt32(&attempts, 0)
+	_, err = c.CreateAsset(ctx, Asset{})
+	assert.Equal(t, true, IsStatus(err, http.StatusServiceUnavailable))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// Until `MaxAttempts`
+	atomic.StoreInt32(&attempts, 2)
+	c.Retry.MaxAttempts = 1
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+	_, err = c.ListAssets(ctx)
+	assert.Equal(t, true, IsStatus(err, http.StatusGatewayTimeout))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestAdminUsers(t *testing.T) {
+	server, database, _ := newServer(t)
+	ctx := context.Background()
+	if err := db.PromoteAdmin(database, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		_, err := New(server.URL).CreateUser(ctx, fmt.Sprintf("user%d", i), "userpass1")
+		assert.Equal(t, nil, err)
+	}
+	c := newClient(server.URL)
+
+	var usernames []string
+	users := c.AdminUsers("", 2)
+	for users.Next(ctx) {
+		usernames = append(usernames, users.User().Username)
+	}
+	assert.Equal(t, nil, users.Err())
+	assert.Equal(t, []string{"test", "user0", "user1", "user2", "user3"}, usernames)
+
+	usernames = nil
+	users = c.AdminUsers("user1", 0)
+	for users.Next(ctx) {
+		usernames = append(usernames, users.User().Username)
+	}
+	assert.Equal(t, []string{"user1"}, usernames)
+
+	users = New(server.URL).AdminUsers("", 0)
+	assert.Equal(t, false, users.Next(ctx))
+	assert.NotEqual(t, nil, users.Err())
+}
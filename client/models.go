@@ -0,0 +1,76 @@
+package client
+
+// Types of the API, see the schemas of api/openapi.yaml.
+
+// User is the public profile of a user. The fields of the complete profile
+// are only set for the user itself.
+type User struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+
+	Email        *string `json:"email,omitempty"`
+	PendingEmail string  `json:"pending_email,omitempty"`
+	Locale       string  `json:"locale,omitempty"`
+	Timezone     string  `json:"timezone,omitempty"`
+}
+
+// ProfileUpdate changes the fields that are not nil, empty values clear them.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+	Timezone    *string `json:"timezone,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+}
+
+// Asset is a chart, insight or audience. `ID` is ignored when assets are
+// created or changed.
+type Asset struct {
+	ID       uint      `json:"id,omitempty"`
+	Chart    *Chart    `json:"chart,omitempty"`
+	Insight  *Insight  `json:"insight,omitempty"`
+	Audience *Audience `json:"audience,omitempty"`
+}
+
+type Chart struct {
+	Title  string `json:"title"`
+	TitleX string `json:"title_x"`
+	TitleY string `json:"title_y"`
+	// Data is base64 encoded
+	Data string `json:"data,omitempty"`
+}
+
+type Insight struct {
+	Description string `json:"description"`
+}
+
+type Audience struct {
+	Characteristics []Characteristic `json:"characteristics,omitempty"`
+}
+
+type Characteristic struct {
+	Gender           string `json:"gender"`
+	BirthCountry     string `json:"birth_country,omitempty"`
+	AgeGroup         string `json:"age_group,omitempty"`
+	SocialMediaHours string `json:"social_media_hours,omitempty"`
+}
+
+// AdminUser is a user with its account state, as seen by administrators.
+type AdminUser struct {
+	ID                uint   `json:"id"`
+	Username          string `json:"username"`
+	Role              string `json:"role"`
+	Disabled          bool   `json:"disabled"`
+	MustResetPassword bool   `json:"must_reset_password"`
+	TOTPEnabled       bool   `json:"totp_enabled"`
+	HasPassword       bool   `json:"has_password"`
+}
+
+type adminUserPage struct {
+	Users    []AdminUser `json:"users"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Total    int         `json:"total"`
+}
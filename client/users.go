@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateUser signs up a new user, which needs no credentials.
+func (c *Client) CreateUser(ctx context.Context, username, password string) (*User, error) {
+	var user User
+	request := map[string]string{"username": username, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/users", true, request, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns the public profiles of all users.
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	return users, c.list(ctx, "/api/v1/users", &users)
+}
+
+// GetUser returns the complete profile of the user itself, and the public
+// profile of other users.
+func (c *Client) GetUser(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, userPath(id), false, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateProfile changes the profile of the user itself.
+func (c *Client) UpdateProfile(ctx context.Context, id uint, update ProfileUpdate) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodPatch, userPath(id), false, update, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser moves the user itself to the trash.
+func (c *Client) DeleteUser(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, userPath(id), false, nil, nil)
+}
+
+// ChangePassword changes the password of the user itself. All its tokens are
+// revoked, so the client continues with the new token and `Password`.
+func (c *Client) ChangePassword(ctx context.Context, id uint, oldPassword, newPassword string) error {
+	var token Token
+	request := map[string]string{"old_password": oldPassword, "new_password": newPassword}
+	if err := c.do(ctx, http.MethodPut, userPath(id)+"/password", false, request, &token); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Password == oldPassword {
+		c.Password = newPassword
+	}
+	if c.APIKey == "" {
+		c.useToken(&token)
+	}
+	return nil
+}
+
+// ListFavourites returns the favourite assets of the user itself.
+func (c *Client) ListFavourites(ctx context.Context, userID uint) ([]Asset, error) {
+	var assets []Asset
+	return assets, c.list(ctx, userPath(userID)+"/favourites", &assets)
+}
+
+// AddFavourite adds the asset `assetID` to the favourites of the user itself.
+func (c *Client) AddFavourite(ctx context.Context, userID, assetID uint) (*Asset, error) {
+	var asset Asset
+	request := map[string]uint{"id": assetID}
+	if err := c.do(ctx, http.MethodPost, userPath(userID)+"/favourites", false, request, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// GetFavourite returns a favourite asset of the user itself.
+func (c *Client) GetFavourite(ctx context.Context, userID, assetID uint) (*Asset, error) {
+	var asset Asset
+	path := fmt.Sprintf("%s/favourites/%d", userPath(userID), assetID)
+	if err := c.do(ctx, http.MethodGet, path, false, nil, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// RemoveFavourite removes the asset `assetID` from the favourites of the
+// user itself. The asset is kept.
+func (c *Client) RemoveFavourite(ctx context.Context, userID, assetID uint) error {
+	path := fmt.Sprintf("%s/favourites/%d", userPath(userID), assetID)
+	return c.do(ctx, http.MethodDelete, path, false, nil, nil)
+}
+
+// list decodes the array at `path`. The API responds with 404 to empty
+// lists, which are returned as empty instead.
+func (c *Client) list(ctx context.Context, path string, out any) error {
+	err := c.do(ctx, http.MethodGet, path, false, nil, out)
+	if IsStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func userPath(id uint) string {
+	return fmt.Sprintf("/api/v1/users/%d", id)
+}
@@ -1,40 +1,386 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/GlobalWebIndex/platform2.0-go-challenge/api"
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/config"
 	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func getSqliteDB() *gorm.DB {
-	database, err := gorm.Open(sqlite.Open("gorm.sqlite"), &gorm.Config{})
+func getSqliteDB(cfg config.Database) *gorm.DB {
+	logger := db.NewLogger(slog.Default(), cfg.SlowQueryThreshold)
+	database, err := gorm.Open(sqlite.Open(cfg.Path), &gorm.Config{Logger: logger})
 	if err != nil {
 		fmt.Fprint(os.Stderr, err.Error())
 		panic("Failed to connect to database")
 	}
+	// Statements are logged without the bound values
+	if err := database.Use(logger); err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		panic("Failed to configure database logger")
+	}
 	db.Migrate(database)
 	return database
 }
 
-func resolveAddress(host, port string) string {
-	if port != "" {
-		return host + ":" + port
+// schedulePurge periodically removes users and assets from the trash once
+// they are older than the retention period, until `ctx` is cancelled.
+func schedulePurge(ctx context.Context, database *gorm.DB, cfg config.Trash) {
+	db.TrashRetention = cfg.Retention
+	db.SchedulePurge(ctx, database, time.Hour, func(err error) {
+		slog.Error("Trash purge failed", "error", err)
+	})
+}
+
+// configurePasswordPolicy sets the minimal length of passwords and loads the
+// list of breached passwords that are refused.
+func configurePasswordPolicy(cfg config.Password) {
+	db.Policy.MinLength = cfg.MinLength
+	if cfg.BreachedFile != "" {
+		breached, err := db.LoadBreachedPasswords(cfg.BreachedFile)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Failed to load breached passwords")
+		}
+		db.Policy.Breached = breached
+	}
+}
+
+// configureJWTKeys loads token signing keys. The signing key is the HS256
+// secret or PEM private key for the configured algorithm. Previous keys that
+// still verify tokens during rotation are listed as "<kid>=<alg>:<pem file>".
+func configureJWTKeys(cfg config.JWT) {
+	api.TokenExpiration = cfg.TokenExpiration
+	material := []byte(cfg.SigningKey)
+	if cfg.SigningKeyFile != "" {
+		var err error
+		if material, err = os.ReadFile(cfg.SigningKeyFile); err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Failed to read JWT signing key file")
+		}
+	}
+	if len(material) == 0 {
+		slog.Warn("No JWT signing key configured, tokens will not survive a restart")
+		return
+	}
+	signing, err := api.NewSigningKey(cfg.KeyID, cfg.Algorithm, material)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		panic("Invalid JWT signing key")
+	}
+
+	var verification []*api.SigningKey
+	for _, entry := range cfg.VerificationKeys {
+		kid, rest, _ := strings.Cut(entry, "=")
+		alg, path, _ := strings.Cut(rest, ":")
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Failed to read JWT verification key")
+		}
+		key, err := api.NewSigningKey(kid, alg, pem)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Invalid JWT verification key")
+		}
+		verification = append(verification, key)
+	}
+
+	keys, err := api.NewKeySet(signing, verification...)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		panic("Invalid JWT keys")
+	}
+	api.SetKeySet(keys)
+}
+
+// configureNotifier delivers notifications, e.g. password reset tokens, into
+// the configured file. Without it, notifications are written to stderr.
+func configureNotifier(cfg config.Notifier) {
+	if cfg.File != "" {
+		notifier, err := api.NewFileNotifier(cfg.File)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Failed to open notifier file")
+		}
+		api.DefaultNotifier = notifier
+	}
+}
+
+// configureOIDC enables login through the OpenID Connect provider, if an
+// issuer is configured.
+func configureOIDC(cfg config.OIDC) {
+	if cfg.Issuer == "" {
+		return
+	}
+	oidcConfig := api.OIDCConfig{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	provider, err := api.NewOIDCProvider(ctx, oidcConfig)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		panic("Failed to configure OIDC provider")
+	}
+	api.DefaultOIDCProvider = provider
+	if cfg.StateSecret != "" {
+		if err := api.SetOIDCStateSecret([]byte(cfg.StateSecret)); err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Failed to configure OIDC state secret")
+		}
+	}
+}
+
+// promoteAdmin gives the admin role to the configured existing user, so
+// that the first administrator can be set up.
+func promoteAdmin(database *gorm.DB, cfg config.Admin) {
+	if cfg.Username == "" {
+		return
+	}
+	if err := db.PromoteAdmin(database, cfg.Username); err != nil {
+		slog.Error("Could not promote admin user", "username", cfg.Username, "error", err)
+	}
+}
+
+// configureTracing sets the global tracer provider exporting spans as
+// configured and returns a function flushing the remaining spans. Without an
+// exporter, the trace context of callers is still propagated to the logs.
+func configureTracing(ctx context.Context, cfg config.Tracing) func() {
+	if cfg.Exporter == "none" {
+		return func() {}
+	}
+	provider, err := api.NewTracerProvider(ctx, api.TracingConfig{
+		Exporter:    cfg.Exporter,
+		Endpoint:    cfg.Endpoint,
+		ServiceName: cfg.ServiceName,
+		SampleRatio: cfg.SampleRatio,
+	})
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		panic("Failed to configure tracing")
+	}
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Tracing failed", "error", err)
+	}))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Error("Could not flush spans", "error", err)
+		}
+	}
+}
+
+// loadConfig loads the configuration from `args` and the environment and
+// exits if it is not valid.
+func loadConfig(args []string) *config.Config {
+	cfg, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	return cfg
+}
+
+// runConfigCommand runs "config print", which shows the effective
+// configuration with secrets redacted.
+func runConfigCommand(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: go_challenge config print [flags]")
+		os.Exit(2)
+	}
+	cfg := loadConfig(args[1:])
+	if err := cfg.Write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// newServer returns a server of `handler` on `port` with the limits in `cfg`.
+func newServer(cfg config.Server, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// configureTLS returns the TLS settings of the server, or nil to serve
+// plaintext. The certificate is reloaded on change until `ctx` is cancelled.
+func configureTLS(ctx context.Context, cfg config.TLS) *tls.Config {
+	if !cfg.Enabled() {
+		return nil
+	}
+	reloader, err := api.NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		panic("Failed to load TLS certificate")
+	}
+	reloader.Watch(ctx, cfg.ReloadInterval, func(err error) {
+		slog.Error("TLS certificate reload failed", "error", err)
+	})
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.ClientAuth != "none" {
+		if tlsConfig.ClientCAs, err = api.LoadCertPool(cfg.ClientCAFile); err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			panic("Failed to load TLS client CAs")
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.ClientAuth == "require" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig
+}
+
+// listen opens the addresses of `servers`, so that a port in use fails the
+// start before any of them serves.
+func listen(servers []*http.Server) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, server := range servers {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// serve runs `servers` on `listeners` until `ctx` is cancelled or one of
+// them fails, then stops accepting connections and lets in-flight requests
+// finish within `shutdownTimeout`. Servers with `TLSConfig` serve HTTPS.
+func serve(ctx context.Context, servers []*http.Server, listeners []net.Listener, shutdownTimeout time.Duration) error {
+	serveErr := make(chan error, len(servers))
+	for i, server := range servers {
+		go func(server *http.Server, listener net.Listener) {
+			slog.Info("Listening", "addr", listener.Addr().String(), "tls", server.TLSConfig != nil)
+			if server.TLSConfig != nil {
+				serveErr <- server.ServeTLS(listener, "", "")
+			} else {
+				serveErr <- server.Serve(listener)
+			}
+		}(server, listeners[i])
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+	}
+	slog.Info("Shutting down, draining requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			// Drops the connections that did not finish in time
+			server.Close()
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+	}
+	return err
+}
+
+// closeDB closes the connection pool of `database`.
+func closeDB(database *gorm.DB) {
+	sqlDB, err := database.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		slog.Error("Could not close database", "error", err)
 	}
-	return host + ":8080"
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfigCommand(os.Args[2:])
+		return
+	}
+	cfg := loadConfig(os.Args[1:])
+	// SIGTERM is sent by Docker on stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	database := getSqliteDB()
- 	// db.FillDB(database)
+	logger := cfg.Log.NewLogger()
+	slog.SetDefault(logger)
+	api.DefaultLogger = logger
+	gin.SetMode(cfg.Server.Mode)
+	shutdownTracing := configureTracing(ctx, cfg.Tracing)
+	defer shutdownTracing()
+	configurePasswordPolicy(cfg.Password)
+	configureJWTKeys(cfg.JWT)
+	configureNotifier(cfg.Notifier)
+	configureOIDC(cfg.OIDC)
+	database := getSqliteDB(cfg.Database)
+	defer closeDB(database)
+	// db.FillDB(database)
+	promoteAdmin(database, cfg.Admin)
+	schedulePurge(ctx, database, cfg.Trash)
+	api.ValidateRequests = cfg.Server.ValidateRequests
+	api.TrustedProxies = cfg.Server.TrustedProxies
 	engine := api.CreateEngine(database)
 
-	addr := resolveAddress(os.Getenv("HOST"), os.Getenv("PORT"))
-	engine.Run(addr)
+	server := newServer(cfg.Server, cfg.Server.Port, engine)
+	server.TLSConfig = configureTLS(ctx, cfg.TLS)
+	servers := []*http.Server{server}
+	if cfg.TLS.RedirectPort != 0 {
+		servers = append(servers, newServer(cfg.Server, cfg.TLS.RedirectPort, api.RedirectToHTTPS(cfg.Server.Port)))
+	}
+	listeners, err := listen(servers)
+	if err == nil {
+		err = serve(ctx, servers, listeners, cfg.Server.ShutdownTimeout)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server failed", "error", err)
+		shutdownTracing()
+		closeDB(database)
+		os.Exit(1)
+	}
 }
 
 /*
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/config"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// startServer serves `handler` on a free local port until the returned
+// context is cancelled. The result of `serve` is sent to the channel.
+func startServer(t *testing.T, handler http.Handler, shutdownTimeout time.Duration) (string, context.CancelFunc, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	server := newServer(config.Default().Server, 0, handler)
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, []*http.Server{server}, []net.Listener{listener}, shutdownTimeout)
+	}()
+	return "http://" + listener.Addr().String(), cancel, done
+}
+
+// slowHandler signals `started` for every request and answers after `delay`.
+func slowHandler(started chan<- struct{}, delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type response struct {
+	code int
+	err  error
+}
+
+func get(url string) <-chan response {
+	result := make(chan response, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			result <- response{err: err}
+			return
+		}
+		resp.Body.Close()
+		result <- response{code: resp.StatusCode}
+	}()
+	return result
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	const shutdownTimeout = 2 * time.Second
+	started := make(chan struct{}, 1)
+	url, cancel, done := startServer(t, slowHandler(started, 200*time.Millisecond), shutdownTimeout)
+
+	result := get(url)
+	<-started
+	shutdown := time.Now()
+	cancel()
+
+	// The in-flight request finishes, new connections are refused
+	got := <-result
+	assert.Equal(t, nil, got.err)
+	assert.Equal(t, http.StatusNoContent, got.code)
+	assert.Equal(t, nil, <-done)
+	assert.Equal(t, true, time.Since(shutdown) < shutdownTimeout)
+	_, err := http.Get(url)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestServeDropsRequestsAfterShutdownTimeout(t *testing.T) {
+	const shutdownTimeout = 100 * time.Millisecond
+	started := make(chan struct{}, 1)
+	url, cancel, done := startServer(t, slowHandler(started, 2*time.Second), shutdownTimeout)
+
+	result := get(url)
+	<-started
+	cancel()
+
+	// The connection is closed before the handler answers
+	err := <-done
+	assert.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+	select {
+	case got := <-result:
+		assert.NotEqual(t, nil, got.err)
+	case <-time.After(time.Second):
+		t.Fatal("request was not dropped")
+	}
+}
+
+func TestCloseDB(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeDB(database)
+	sqlDB, err := database.DB()
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, nil, sqlDB.Ping())
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/client"
+)
+
+const assetsUsage = `Usage: gwi assets list
+       gwi assets get <id>
+       gwi assets create [-f file]
+       gwi assets update <id> [-f file]
+       gwi assets replace <id> [-f file]
+       gwi assets delete <id>
+
+Assets are read as JSON from the file or stdin, e.g.
+  {"insight": {"description": "40% of millenials spend 3 hours on social media"}}
+`
+
+const favouritesUsage = `Usage: gwi favourites list
+       gwi favourites add <asset id>
+       gwi favourites remove <asset id>
+`
+
+const transferUsage = `Usage: gwi export [-favourites] [-f file]
+       gwi import [-favourites] [-f file]
+
+The file is a JSON array of assets, stdout or stdin by default.
+`
+
+// errUnknownUser is returned by commands on favourites with an API key of an
+// unknown user.
+var errUnknownUser = errors.New("the user of the API key is unknown, run gwi login with -user-id")
+
+func (cli *cli) assets(ctx context.Context, args []string) error {
+	flags := cli.flagSet("assets", assetsUsage)
+	file := flags.String("f", "-", "JSON file of the asset, - for stdin")
+	command, id, err := cli.parseCommand(flags, args, map[string]bool{
+		"list": false, "get": true, "create": false, "update": true, "replace": true, "delete": true,
+	})
+	if err != nil {
+		return err
+	}
+	c, _, err := cli.newClient()
+	if err != nil {
+		return err
+	}
+
+	var asset *client.Asset
+	switch command {
+	case "list":
+		assets, err := c.ListAssets(ctx)
+		if err != nil {
+			return sessionError(err)
+		}
+		return cli.printAssets(assets)
+	case "get":
+		asset, err = c.GetAsset(ctx, id)
+	case "create", "update", "replace":
+		var input client.Asset
+		if err := cli.readJSON(*file, &input); err != nil {
+			return err
+		}
+		switch command {
+		case "create":
+			asset, err = c.CreateAsset(ctx, input)
+		case "update":
+			asset, err = c.UpdateAsset(ctx, id, input)
+		default:
+			asset, err = c.ReplaceAsset(ctx, id, input)
+		}
+	case "delete":
+		if err := c.DeleteAsset(ctx, id); err != nil {
+			return sessionError(err)
+		}
+		cli.done("Deleted asset %d", id)
+		return nil
+	}
+	if err != nil {
+		return sessionError(err)
+	}
+	return cli.printAsset(asset)
+}
+
+func (cli *cli) favourites(ctx context.Context, args []string) error {
+	flags := cli.flagSet("favourites", favouritesUsage)
+	command, id, err := cli.parseCommand(flags, args, map[string]bool{"list": false, "add": true, "remove": true})
+	if err != nil {
+		return err
+	}
+	c, s, err := cli.newClient()
+	if err != nil {
+		return err
+	}
+	if s.UserID == 0 {
+		return errUnknownUser
+	}
+
+	switch command {
+	case "list":
+		assets, err := c.ListFavourites(ctx, s.UserID)
+		if err != nil {
+			return sessionError(err)
+		}
+		return cli.printAssets(assets)
+	case "add":
+		asset, err := c.AddFavourite(ctx, s.UserID, id)
+		if err != nil {
+			return sessionError(err)
+		}
+		// The API only returns the id of the asset
+		if cli.output == "json" {
+			return cli.printAsset(asset)
+		}
+		cli.done("Added asset %d to favourites", id)
+		return nil
+	}
+	if err := c.RemoveFavourite(ctx, s.UserID, id); err != nil {
+		return sessionError(err)
+	}
+	cli.done("Removed asset %d from favourites", id)
+	return nil
+}
+
+// export writes the assets, or the favourites, in the format read by import.
+func (cli *cli) export(ctx context.Context, args []string) error {
+	flags := cli.flagSet("export", transferUsage)
+	favourites := flags.Bool("favourites", false, "export the favourites instead of all assets")
+	file := flags.String("f", "-", "file written, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	c, s, err := cli.newClient()
+	if err != nil {
+		return err
+	}
+	if *favourites && s.UserID == 0 {
+		return errUnknownUser
+	}
+	var assets []client.Asset
+	if *favourites {
+		assets, err = c.ListFavourites(ctx, s.UserID)
+	} else {
+		assets, err = c.ListAssets(ctx)
+	}
+	if err != nil {
+		return sessionError(err)
+	}
+	if assets == nil {
+		assets = []client.Asset{}
+	}
+
+	out := cli.stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(assets); err != nil {
+		return err
+	}
+	if *file != "-" {
+		cli.done("Exported %d assets to %s", len(assets), *file)
+	}
+	return nil
+}
+
+// importAssets creates the assets of an export as new assets. The ids in the
+// export are ignored.
+func (cli *cli) importAssets(ctx context.Context, args []string) error {
+	flags := cli.flagSet("import", transferUsage)
+	favourites := flags.Bool("favourites", false, "add the created assets to the favourites")
+	file := flags.String("f", "-", "file read, - for stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var assets []client.Asset
+	if err := cli.readJSON(*file, &assets); err != nil {
+		return err
+	}
+	c, s, err := cli.newClient()
+	if err != nil {
+		return err
+	}
+	if *favourites && s.UserID == 0 {
+		return errUnknownUser
+	}
+
+	created := make([]client.Asset, 0, len(assets))
+	for i, asset := range assets {
+		result, err := c.CreateAsset(ctx, asset)
+		if err == nil && *favourites {
+			_, err = c.AddFavourite(ctx, s.UserID, result.ID)
+		}
+		if err != nil {
+			// The assets created so far are listed, so that they are not
+			// imported twice
+			_ = cli.printAssets(created)
+			return fmt.Errorf("asset %d of %s: %w", i+1, *file, sessionError(err))
+		}
+		created = append(created, *result)
+	}
+	return cli.printAssets(created)
+}
+
+// parseCommand parses the subcommand in `args`, its id and the flags after
+// it. `commands` tells whether each subcommand takes an id.
+func (cli *cli) parseCommand(flags *flag.FlagSet, args []string, commands map[string]bool) (string, uint, error) {
+	if len(args) == 0 {
+		return "", 0, cli.usageError(flags, "")
+	}
+	command := args[0]
+	needsID, known := commands[command]
+	if !known {
+		return "", 0, cli.usageError(flags, "unknown command "+command)
+	}
+	args = args[1:]
+	var id uint
+	if needsID {
+		if len(args) == 0 {
+			return "", 0, cli.usageError(flags, command+" needs an id")
+		}
+		parsed, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil {
+			return "", 0, cli.usageError(flags, fmt.Sprintf("invalid id %q", args[0]))
+		}
+		id, args = uint(parsed), args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return "", 0, err
+	}
+	if flags.NArg() > 0 {
+		return "", 0, cli.usageError(flags, "unexpected arguments")
+	}
+	return command, id, nil
+}
+
+// readJSON decodes the file `path`, or stdin for "-", into `out`.
+func (cli *cli) readJSON(path string, out any) error {
+	in := cli.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s is not valid: %w", path, err)
+	}
+	return nil
+}
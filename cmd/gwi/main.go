@@ -0,0 +1,133 @@
+// Command gwi calls the API from the command line:
+//
+//	gwi login -server http://localhost:8080 -username test
+//	gwi assets create -f asset.json
+//	gwi favourites add 3
+//	gwi -output json favourites list
+//	gwi export -f assets.json
+//
+// The token of `login` is kept in $GWI_CONFIG, by default gwi/config.json in
+// the user config directory, until `logout`.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+)
+
+const usage = `Usage: gwi [-output table|json] [-config file] <command> [arguments]
+
+Commands:
+  login       log in and keep the token, -h for the flags
+  logout      revoke the token and forget it
+  assets      list | get <id> | create | update <id> | replace <id> | delete <id>
+  favourites  list | add <asset id> | remove <asset id>
+  export      write assets, or favourites with -favourites, as JSON
+  import      create the assets of an export, -favourites adds them to favourites
+`
+
+// errUsage is returned for invalid arguments, after the usage was printed.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	cli := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	err := cli.run(ctx, os.Args[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "gwi: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+// cli runs one command, with the environment of the process.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	getenv         func(string) string
+	// lines buffers `stdin` for prompts
+	lines *bufio.Reader
+
+	// output is "table" or "json"
+	output      string
+	sessionPath string
+}
+
+func (cli *cli) run(ctx context.Context, args []string) error {
+	flags := cli.flagSet("gwi", usage)
+	flags.StringVar(&cli.output, "output", cli.envOr("GWI_OUTPUT", "table"), "output format: table or json ($GWI_OUTPUT)")
+	flags.StringVar(&cli.sessionPath, "config", cli.getenv("GWI_CONFIG"), "file keeping the token ($GWI_CONFIG)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cli.output != "table" && cli.output != "json" {
+		return cli.usageError(flags, "-output must be table or json")
+	}
+	if cli.sessionPath == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		cli.sessionPath = filepath.Join(dir, "gwi", "config.json")
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		return cli.usageError(flags, "")
+	}
+	switch args[0] {
+	case "login":
+		return cli.login(ctx, args[1:])
+	case "logout":
+		return cli.logout(ctx)
+	case "assets":
+		return cli.assets(ctx, args[1:])
+	case "favourites":
+		return cli.favourites(ctx, args[1:])
+	case "export":
+		return cli.export(ctx, args[1:])
+	case "import":
+		return cli.importAssets(ctx, args[1:])
+	case "help":
+		fmt.Fprint(cli.stdout, usage)
+		return nil
+	}
+	return cli.usageError(flags, "unknown command "+args[0])
+}
+
+// flagSet returns flags printing `usage` and the defaults on errors.
+func (cli *cli) flagSet(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(cli.stderr)
+	flags.Usage = func() {
+		fmt.Fprint(cli.stderr, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func (cli *cli) usageError(flags *flag.FlagSet, message string) error {
+	if message != "" {
+		fmt.Fprintln(cli.stderr, message)
+	}
+	flags.Usage()
+	return errUsage
+}
+
+func (cli *cli) envOr(key, fallback string) string {
+	if value := cli.getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/api"
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/client"
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// testCLI runs commands against the API with the fixtures of `db.FillDB`,
+// keeping its session in a temporary directory.
+type testCLI struct {
+	t      *testing.T
+	env    map[string]string
+	config string
+}
+
+func newTestCLI(t *testing.T) *testCLI {
+	gin.SetMode(gin.TestMode)
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Migrate(database)
+	db.FillDB(database)
+	server := httptest.NewServer(api.CreateTestEngine(database, true))
+	t.Cleanup(server.Close)
+	config := filepath.Join(t.TempDir(), "gwi", "config.json")
+	return &testCLI{t: t, config: config, env: map[string]string{
+		"GWI_SERVER": server.URL, "GWI_CONFIG": config, "GWI_PASSWORD": "testpass1",
+	}}
+}
+
+// run returns stdout and stderr of the command `args` with `stdin`.
+func (tc *testCLI) run(stdin string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cli := &cli{
+		stdin:  strings.NewReader(stdin),
+		stdout: &stdout,
+		stderr: &stderr,
+		getenv: func(key string) string { return tc.env[key] },
+	}
+	err := cli.run(context.Background(), args)
+	return stdout.String(), stderr.String(), err
+}
+
+// mustRun fails the test if the command fails.
+func (tc *testCLI) mustRun(stdin string, args ...string) string {
+	stdout, stderr, err := tc.run(stdin, args...)
+	if err != nil {
+		tc.t.Fatalf("gwi %s: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return stdout
+}
+
+func decodeAssets(t *testing.T, output string) []client.Asset {
+	var assets []client.Asset
+	if err := json.Unmarshal([]byte(output), &assets); err != nil {
+		t.Fatal(err)
+	}
+	return assets
+}
+
+func decodeAsset(t *testing.T, output string) client.Asset {
+	var asset client.Asset
+	if err := json.Unmarshal([]byte(output), &asset); err != nil {
+		t.Fatal(err)
+	}
+	return asset
+}
+
+func TestLogin(t *testing.T) {
+	tc := newTestCLI(t)
+
+	_, _, err := tc.run("", "assets", "list")
+	assert.Equal(t, errNotLoggedIn, err)
+	_, stderr, err := tc.run("", "login")
+	assert.Equal(t, errUsage, err)
+	assert.Equal(t, true, strings.Contains(stderr, "-username"))
+
+	// The password is asked for without $GWI_PASSWORD
+	delete(tc.env, "GWI_PASSWORD")
+	_, _, err = tc.run("wrong\n", "login", "-username", "test")
+	assert.Equal(t, true, client.IsStatus(err, 401))
+	_, stderr, err = tc.run("testpass1\n", "login", "-username", "test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.Contains(stderr, "Logged in as test"))
+
+	info, err := os.Stat(tc.config)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	tc.mustRun("", "assets", "list")
+
+	tc.mustRun("", "logout")
+	_, err = os.Stat(tc.config)
+	assert.Equal(t, true, os.IsNotExist(err))
+	_, _, err = tc.run("", "assets", "list")
+	assert.Equal(t, errNotLoggedIn, err)
+}
+
+func TestExpiredSession(t *testing.T) {
+	tc := newTestCLI(t)
+	tc.mustRun("", "login", "-username", "test")
+
+	var cli = &cli{sessionPath: tc.config}
+	s, err := cli.loadSession()
+	assert.Equal(t, nil, err)
+	s.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, nil, cli.saveSession(s))
+	_, _, err = tc.run("", "assets", "list")
+	assert.Equal(t, "session expired, run gwi login", err.Error())
+	// Expired tokens need no revocation
+	tc.mustRun("", "logout")
+}
+
+func TestAssetsAndFavourites(t *testing.T) {
+	tc := newTestCLI(t)
+	tc.mustRun("", "login", "-username", "test")
+
+	output := tc.mustRun(`{"insight": {"description": "40% of millenials"}}`, "-output", "json", "assets", "create")
+	id := decodeAsset(t, output).ID
+	assert.NotEqual(t, uint(0), id)
+	idArg := strconv.FormatUint(uint64(id), 10)
+
+	output = tc.mustRun("", "assets", "get", idArg)
+	assert.Equal(t, true, strings.Contains(output, "ID"))
+	assert.Equal(t, true, strings.Contains(output, "insight  40% of millenials"))
+
+	file := filepath.Join(t.TempDir(), "update.json")
+	assert.Equal(t, nil, os.WriteFile(file, []byte(`{"insight": {"description": "45% of millenials"}}`), 0o600))
+	tc.mustRun("", "assets", "update", idArg, "-f", file)
+	output = tc.mustRun("", "-output", "json", "assets", "get", idArg)
+	assert.Equal(t, "45% of millenials", decodeAsset(t, output).Insight.Description)
+
+	output = tc.mustRun("", "favourites", "list")
+	assert.Equal(t, "ID  TYPE  SUMMARY\n", output)
+	tc.mustRun("", "favourites", "add", idArg)
+	output = tc.mustRun("", "-output", "json", "favourites", "list")
+	assert.Equal(t, id, decodeAssets(t, output)[0].ID)
+	_, stderr, err := tc.run("", "favourites", "remove", idArg)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.Contains(stderr, "Removed asset"))
+
+	tc.mustRun("", "assets", "delete", idArg)
+	_, _, err = tc.run("", "assets", "get", idArg)
+	assert.Equal(t, true, client.IsStatus(err, 404))
+
+	_, _, err = tc.run("", "assets", "get", "one")
+	assert.Equal(t, errUsage, err)
+	_, _, err = tc.run("", "assets", "rename")
+	assert.Equal(t, errUsage, err)
+	_, _, err = tc.run("", "-output", "yaml", "assets", "list")
+	assert.Equal(t, errUsage, err)
+}
+
+func TestExportImport(t *testing.T) {
+	tc := newTestCLI(t)
+	tc.mustRun("", "login", "-username", "test")
+	tc.mustRun("", "favourites", "add", "2")
+	tc.mustRun("", "favourites", "add", "3")
+
+	file := filepath.Join(t.TempDir(), "favourites.json")
+	tc.mustRun("", "export", "-favourites", "-f", file)
+	data, err := os.ReadFile(file)
+	assert.Equal(t, nil, err)
+	exported := decodeAssets(t, string(data))
+	assert.Equal(t, 2, len(exported))
+
+	before := decodeAssets(t, tc.mustRun("", "export"))
+	output := tc.mustRun("", "-output", "json", "import", "-favourites", "-f", file)
+	imported := decodeAssets(t, output)
+	assert.Equal(t, 2, len(imported))
+	assert.NotEqual(t, exported[0].ID, imported[0].ID)
+	after := decodeAssets(t, tc.mustRun("", "export"))
+	assert.Equal(t, len(before)+2, len(after))
+	favourites := decodeAssets(t, tc.mustRun("", "-output", "json", "favourites", "list"))
+	assert.Equal(t, 4, len(favourites))
+
+	_, _, err = tc.run("not json", "import")
+	assert.NotEqual(t, nil, err)
+}
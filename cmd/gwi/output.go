@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/client"
+)
+
+// summaryLength is the width of the summary column of tables.
+const summaryLength = 60
+
+// printAssets prints `assets` as a table with a row per part of each asset,
+// or as a JSON array.
+func (cli *cli) printAssets(assets []client.Asset) error {
+	if cli.output == "json" {
+		if assets == nil {
+			assets = []client.Asset{}
+		}
+		encoder := json.NewEncoder(cli.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(assets)
+	}
+	table := tabwriter.NewWriter(cli.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTYPE\tSUMMARY")
+	for _, asset := range assets {
+		for _, part := range assetParts(asset) {
+			fmt.Fprintf(table, "%d\t%s\t%s\n", asset.ID, part[0], truncate(part[1]))
+		}
+	}
+	return table.Flush()
+}
+
+// printAsset prints a single asset like `printAssets`, as a JSON object.
+func (cli *cli) printAsset(asset *client.Asset) error {
+	if cli.output == "json" {
+		encoder := json.NewEncoder(cli.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(asset)
+	}
+	return cli.printAssets([]client.Asset{*asset})
+}
+
+// assetParts returns the type and summary of the chart, insight and audience
+// of `asset`.
+func assetParts(asset client.Asset) [][2]string {
+	var parts [][2]string
+	if asset.Chart != nil {
+		parts = append(parts, [2]string{"chart", asset.Chart.Title})
+	}
+	if asset.Insight != nil {
+		parts = append(parts, [2]string{"insight", asset.Insight.Description})
+	}
+	if asset.Audience != nil {
+		var genders []string
+		for _, characteristic := range asset.Audience.Characteristics {
+			genders = append(genders, characteristic.Gender)
+		}
+		summary := fmt.Sprintf("%d characteristics", len(genders))
+		if len(genders) > 0 {
+			summary += " (" + strings.Join(genders, ", ") + ")"
+		}
+		parts = append(parts, [2]string{"audience", summary})
+	}
+	if len(parts) == 0 {
+		parts = append(parts, [2]string{"-", ""})
+	}
+	return parts
+}
+
+func truncate(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= summaryLength {
+		return text
+	}
+	return string(runes[:summaryLength-1]) + "…"
+}
+
+// done reports the success of commands without output, in table mode only.
+func (cli *cli) done(format string, args ...any) {
+	if cli.output == "table" {
+		fmt.Fprintf(cli.stderr, format+"\n", args...)
+	}
+}
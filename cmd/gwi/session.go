@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/client"
+	"golang.org/x/term"
+)
+
+const loginUsage = `Usage: gwi login [-server url] -username name [-scopes a,b]
+       gwi login [-server url] -api-key key [-user-id id]
+
+The password is read from $GWI_PASSWORD or asked for.
+`
+
+// errNotLoggedIn is returned by commands without a session.
+var errNotLoggedIn = errors.New("not logged in, run gwi login")
+
+// session is what `login` keeps for the following commands.
+type session struct {
+	Server    string    `json:"server"`
+	Username  string    `json:"username,omitempty"`
+	UserID    uint      `json:"user_id,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	APIKey    string    `json:"api_key,omitempty"`
+}
+
+func (cli *cli) loadSession() (*session, error) {
+	data, err := os.ReadFile(cli.sessionPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotLoggedIn
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", cli.sessionPath, err)
+	}
+	return &s, nil
+}
+
+// saveSession writes `s` readable only by the user, as it holds a token.
+func (cli *cli) saveSession(s *session) error {
+	if err := os.MkdirAll(filepath.Dir(cli.sessionPath), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(cli.sessionPath, data, 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of existing files
+	return os.Chmod(cli.sessionPath, 0o600)
+}
+
+// newClient returns a client of the session, which does not log in again.
+func (cli *cli) newClient() (*client.Client, *session, error) {
+	s, err := cli.loadSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := client.New(s.Server)
+	if s.APIKey != "" {
+		c.APIKey = s.APIKey
+	} else {
+		c.SetToken(s.Token, s.ExpiresAt)
+	}
+	return c, s, nil
+}
+
+// sessionError explains errors of expired or revoked sessions.
+func sessionError(err error) error {
+	if errors.Is(err, client.ErrNoCredentials) {
+		return errors.New("session expired, run gwi login")
+	}
+	return err
+}
+
+func (cli *cli) login(ctx context.Context, args []string) error {
+	server := cli.envOr("GWI_SERVER", "http://localhost:8080")
+	if s, err := cli.loadSession(); err == nil {
+		server = s.Server
+	}
+	flags := cli.flagSet("login", loginUsage)
+	flags.StringVar(&server, "server", server, "URL of the API ($GWI_SERVER)")
+	username := flags.String("username", "", "user to log in as")
+	scopes := flags.String("scopes", "", "comma separated scopes of the token, all scopes by default")
+	apiKey := flags.String("api-key", "", "API key used instead of a token")
+	userID := flags.Uint("user-id", 0, "id of the user of the API key, needed for favourites")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*username == "") == (*apiKey == "") {
+		return cli.usageError(flags, "either -username or -api-key is required")
+	}
+
+	s := &session{Server: strings.TrimSuffix(server, "/"), APIKey: *apiKey, UserID: *userID}
+	if *apiKey == "" {
+		c := client.New(s.Server)
+		c.Username = *username
+		if *scopes != "" {
+			c.Scopes = strings.Split(*scopes, ",")
+		}
+		c.TOTP = func(ctx context.Context) (string, error) {
+			return cli.prompt("Two-factor code: ", false)
+		}
+		if c.Password = cli.getenv("GWI_PASSWORD"); c.Password == "" {
+			password, err := cli.prompt("Password: ", true)
+			if err != nil {
+				return err
+			}
+			c.Password = password
+		}
+		token, err := c.Login(ctx)
+		if err != nil {
+			return err
+		}
+		s.Username, s.UserID = *username, token.UserID
+		s.Token, s.ExpiresAt = c.CurrentToken()
+	}
+	if err := cli.saveSession(s); err != nil {
+		return err
+	}
+	if s.Token != "" {
+		fmt.Fprintf(cli.stderr, "Logged in as %s until %s\n", s.Username, s.ExpiresAt.Local().Format(time.RFC1123))
+	}
+	return nil
+}
+
+// logout revokes the token, and forgets the session even if that failed.
+func (cli *cli) logout(ctx context.Context) error {
+	c, s, err := cli.newClient()
+	if errors.Is(err, errNotLoggedIn) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.Token != "" {
+		err = c.Logout(ctx)
+	}
+	if removeErr := os.Remove(cli.sessionPath); removeErr != nil {
+		return removeErr
+	}
+	// Expired tokens need no revocation
+	if errors.Is(err, client.ErrNoCredentials) {
+		return nil
+	}
+	return err
+}
+
+// prompt asks for a line on the terminal, without echo for `secret` input.
+func (cli *cli) prompt(message string, secret bool) (string, error) {
+	fmt.Fprint(cli.stderr, message)
+	if file, ok := cli.stdin.(*os.File); ok && secret && term.IsTerminal(int(file.Fd())) {
+		line, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(cli.stderr)
+		return string(line), err
+	}
+	if cli.lines == nil {
+		cli.lines = bufio.NewReader(cli.stdin)
+	}
+	line, err := cli.lines.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading %s%w", strings.ToLower(message), err)
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,509 @@
+// Package config loads the settings of the server from a YAML or TOML file, the
+// environment and command line flags. Flags take precedence over the
+// environment, which takes precedence over the file and the defaults.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/api"
+	"github.com/GlobalWebIndex/platform2.0-go-challenge/db"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective configuration of the server. Every setting has a
+// key in the file, e.g. "jwt.token_expiration", the same flag
+// "-jwt.token-expiration" and an environment variable in its "env" tag.
+// Settings tagged "secret" are redacted when printed.
+type Config struct {
+	Server   Server   `yaml:"server"`
+	TLS      TLS      `yaml:"tls"`
+	Database Database `yaml:"database"`
+	JWT      JWT      `yaml:"jwt"`
+	Password Password `yaml:"password"`
+	Trash    Trash    `yaml:"trash"`
+	Notifier Notifier `yaml:"notifier"`
+	OIDC     OIDC     `yaml:"oidc"`
+	Admin    Admin    `yaml:"admin"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+}
+
+type Server struct {
+	Host string `yaml:"host" env:"HOST" usage:"interface to listen on, all by default"`
+	Port int    `yaml:"port" env:"PORT" usage:"port to listen on"`
+	// Mode is the gin mode, "debug", "release" or "test"
+	Mode              string        `yaml:"mode" env:"GIN_MODE" usage:"gin mode: debug, release or test"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" usage:"maximum duration for reading a request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" usage:"maximum duration for reading request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" usage:"maximum duration for writing a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" usage:"how long idle keep-alive connections are kept"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" usage:"maximum size of request headers"`
+	// ShutdownTimeout is how long in-flight requests can finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" usage:"deadline for draining requests on shutdown"`
+	// ValidateRequests checks requests against the OpenAPI document
+	ValidateRequests bool `yaml:"validate_requests" env:"VALIDATE_REQUESTS" usage:"refuse requests that do not match the OpenAPI document"`
+	// TrustedProxies may name the client in "X-Forwarded-For", none by default
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"addresses or CIDRs of reverse proxies trusted for the client IP"`
+}
+
+type TLS struct {
+	CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate chain, enables HTTPS"`
+	KeyFile  string `yaml:"key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the certificate"`
+	// ReloadInterval is how often the files are checked for a renewed certificate
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"how often the certificate files are checked for changes"`
+	// ClientAuth is "none", "optional" or "require"
+	ClientAuth   string `yaml:"client_auth" env:"TLS_CLIENT_AUTH" usage:"client certificates: none, optional or require"`
+	ClientCAFile string `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"PEM certificates of the CAs issuing client certificates"`
+	// RedirectPort serves plaintext redirects to HTTPS, if set
+	RedirectPort int `yaml:"redirect_port" env:"TLS_REDIRECT_PORT" usage:"port redirecting HTTP to HTTPS, disabled with 0"`
+}
+
+// Enabled reports whether the server is configured for HTTPS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+type Database struct {
+	Path string `yaml:"path" env:"DB_PATH" usage:"path of the sqlite database"`
+	// SlowQueryThreshold logs slower statements as warnings
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD" usage:"statements taking longer are logged as slow"`
+}
+
+type JWT struct {
+	TokenExpiration time.Duration `yaml:"token_expiration" env:"TOKEN_EXPIRATION" usage:"lifetime of access tokens"`
+	Algorithm       string        `yaml:"algorithm" env:"JWT_ALGORITHM" usage:"signing algorithm: HS256, RS256, ES256 or EdDSA"`
+	KeyID           string        `yaml:"key_id" env:"JWT_KEY_ID" usage:"\"kid\" of the signing key"`
+	SigningKey      string        `yaml:"signing_key" env:"JWT_SIGNING_KEY" secret:"true" usage:"HS256 secret or PEM private key"`
+	SigningKeyFile  string        `yaml:"signing_key_file" env:"JWT_SIGNING_KEY_FILE" usage:"file with the signing key"`
+	// VerificationKeys of previous keys during rotation, as "<kid>=<alg>:<pem file>"
+	VerificationKeys []string `yaml:"verification_keys" env:"JWT_VERIFICATION_KEYS" usage:"previous keys as <kid>=<alg>:<pem file>,..."`
+}
+
+type Password struct {
+	MinLength    int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" usage:"minimal length of passwords"`
+	BreachedFile string `yaml:"breached_file" env:"BREACHED_PASSWORDS_FILE" usage:"file with refused passwords"`
+}
+
+type Trash struct {
+	Retention time.Duration `yaml:"retention" env:"TRASH_RETENTION" usage:"how long deleted users and assets are kept"`
+}
+
+type Notifier struct {
+	File string `yaml:"file" env:"NOTIFIER_FILE" usage:"file notifications are written to, stderr by default"`
+}
+
+type OIDC struct {
+	Issuer       string   `yaml:"issuer" env:"OIDC_ISSUER" usage:"OpenID Connect provider, disabled by default"`
+	ClientID     string   `yaml:"client_id" env:"OIDC_CLIENT_ID" usage:"client id at the provider"`
+	ClientSecret string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" usage:"client secret at the provider"`
+	RedirectURL  string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL" usage:"public URL of /api/v1/oidc/callback"`
+	Scopes       []string `yaml:"scopes" env:"OIDC_SCOPES" usage:"additional scopes requested from the provider"`
+	StateSecret  string   `yaml:"state_secret" env:"OIDC_STATE_SECRET" secret:"true" usage:"secret of at least 32 bytes signing the login state, random by default"`
+}
+
+type Admin struct {
+	Username string `yaml:"username" env:"ADMIN_USERNAME" usage:"existing user promoted to administrator"`
+}
+
+type Log struct {
+	// Level is "debug", "info", "warn" or "error"
+	Level string `yaml:"level" env:"LOG_LEVEL" usage:"minimal level: debug, info, warn or error"`
+	// Format is "json" or "text"
+	Format string `yaml:"format" env:"LOG_FORMAT" usage:"log format: json or text"`
+}
+
+type Tracing struct {
+	// Exporter is "none", "otlp" or "stdout"
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" usage:"span exporter: none, otlp or stdout"`
+	// Endpoint of the OTLP/HTTP collector, e.g. "http://localhost:4318"
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" usage:"URL of the OTLP/HTTP collector"`
+	ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME" usage:"service name of the spans"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" usage:"ratio of new traces that are sampled, from 0 to 1"`
+}
+
+// FileEnv names the environment variable with the path of the config file,
+// which can also be given by the "-config" flag.
+const FileEnv = "CONFIG_FILE"
+
+// Redacted replaces the value of secrets when printed.
+const Redacted = "<redacted>"
+
+// Default returns the configuration used for settings that are not set.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              8080,
+			Mode:              "debug",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 16,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		TLS:      TLS{ReloadInterval: time.Minute, ClientAuth: "none"},
+		Database: Database{Path: "gorm.sqlite", SlowQueryThreshold: 200 * time.Millisecond},
+		JWT: JWT{
+			TokenExpiration: api.TokenExpiration,
+			Algorithm:       api.AlgHS256,
+			KeyID:           "default",
+		},
+		Password: Password{MinLength: db.Policy.MinLength},
+		Trash:    Trash{Retention: db.TrashRetention},
+		OIDC:     OIDC{Scopes: []string{"profile", "email"}},
+		Log:      Log{Level: "info", Format: "json"},
+		Tracing:  Tracing{Exporter: "none", ServiceName: "go_challenge", SampleRatio: 1},
+	}
+}
+
+// Load returns the configuration from the defaults, the config file, the
+// environment read by `getenv` and the flags in `args`, in this order.
+// Empty environment variables are ignored.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	flags := flag.NewFlagSet("go_challenge", flag.ContinueOnError)
+	path := flags.String("config", "", "YAML config file, also $"+FileEnv)
+	var fromFlags []*flagValue
+	for _, s := range settings {
+		value := &flagValue{setting: s}
+		fromFlags = append(fromFlags, value)
+		usage := s.usage
+		if s.env != "" {
+			usage += " ($" + s.env + ")"
+		}
+		flags.Var(value, s.flag(), usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *path == "" {
+		*path = getenv(FileEnv)
+	}
+	if *path != "" {
+		if err := cfg.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if raw := getenv(s.env); s.env != "" && raw != "" {
+			if err := s.set(raw); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, value := range fromFlags {
+		if value.raw != nil {
+			// Already checked by `flagValue.Set`
+			_ = value.setting.set(*value.raw)
+		}
+	}
+	return cfg, nil
+}
+
+// readFile decodes the YAML (or JSON) or TOML file at `path` into `c`.
+// Unknown keys are refused, so that typos do not go unnoticed.
+func (c *Config) readFile(path string) error {
+	var content io.Reader
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		content = file
+	case ".toml":
+		converted, err := tomlToYAML(path)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		content = bytes.NewReader(converted)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use YAML or TOML", path)
+	}
+	decoder := yaml.NewDecoder(content)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// tomlToYAML converts the TOML file at `path` to YAML, so that both formats
+// share the keys and checks of the "yaml" tags.
+func tomlToYAML(path string) ([]byte, error) {
+	var document map[string]interface{}
+	if _, err := toml.DecodeFile(path, &document); err != nil {
+		return nil, err
+	}
+	if len(document) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(document)
+}
+
+// Validate checks the configuration and returns all problems found at once.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535")
+	check(c.Server.Mode == "debug" || c.Server.Mode == "release" || c.Server.Mode == "test",
+		"server.mode must be debug, release or test")
+	check(c.Server.ReadTimeout > 0 && c.Server.ReadHeaderTimeout > 0 && c.Server.WriteTimeout > 0 && c.Server.IdleTimeout > 0,
+		"server timeouts must be positive")
+	check(c.Server.ReadHeaderTimeout <= c.Server.ReadTimeout, "server.read_header_timeout cannot exceed server.read_timeout")
+	check(c.Server.MaxHeaderBytes >= 4096, "server.max_header_bytes must be at least 4096")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies entry %q must be an IP address or CIDR", proxy)
+	}
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval must be positive")
+	switch c.TLS.ClientAuth {
+	case "none":
+	case "optional", "require":
+		check(c.TLS.Enabled() && c.TLS.ClientCAFile != "", "tls.client_auth requires tls.cert_file and tls.client_ca_file")
+	default:
+		check(false, "tls.client_auth must be none, optional or require")
+	}
+	if c.TLS.RedirectPort != 0 {
+		check(c.TLS.Enabled(), "tls.redirect_port requires tls.cert_file")
+		check(c.TLS.RedirectPort > 0 && c.TLS.RedirectPort < 65536 && c.TLS.RedirectPort != c.Server.Port,
+			"tls.redirect_port must be between 1 and 65535 and differ from server.port")
+	}
+	check(c.Database.Path != "", "database.path is required")
+	check(c.Database.SlowQueryThreshold >= 0, "database.slow_query_threshold cannot be negative")
+	check(c.JWT.TokenExpiration > 0, "jwt.token_expiration must be positive")
+	check(isAlgorithm(c.JWT.Algorithm), "jwt.algorithm %q is not supported", c.JWT.Algorithm)
+	check(c.JWT.KeyID != "", "jwt.key_id is required")
+	check(c.JWT.SigningKey == "" || c.JWT.SigningKeyFile == "",
+		"jwt.signing_key and jwt.signing_key_file cannot be used together")
+	for _, entry := range c.JWT.VerificationKeys {
+		kid, rest, hasKid := strings.Cut(entry, "=")
+		alg, path, hasPath := strings.Cut(rest, ":")
+		check(hasKid && hasPath && kid != "" && isAlgorithm(alg) && path != "",
+			"jwt.verification_keys entry %q must be <kid>=<alg>:<pem file>", entry)
+	}
+	check(c.Password.MinLength > 0, "password.min_length must be positive")
+	check(c.Password.MinLength <= db.Policy.MaxLength, "password.min_length must be at most %d", db.Policy.MaxLength)
+	check(c.Trash.Retention > 0, "trash.retention must be positive")
+	if c.OIDC.Issuer != "" {
+		check(c.OIDC.ClientID != "", "oidc.client_id is required with oidc.issuer")
+		check(c.OIDC.RedirectURL != "", "oidc.redirect_url is required with oidc.issuer")
+		check(c.OIDC.StateSecret == "" || len(c.OIDC.StateSecret) >= 32,
+			"oidc.state_secret must be at least 32 bytes long")
+	}
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error")
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text")
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout",
+		"tracing.exporter must be none, otlp or stdout")
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// NewLogger returns the logger to stderr configured in `Log`.
+func (l Log) NewLogger() *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(l.Level))
+	options := &slog.HandlerOptions{Level: level}
+	if l.Format == "text" {
+		return slog.New(slog.NewTextHandler(os.Stderr, options))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, options))
+}
+
+func isAlgorithm(alg string) bool {
+	switch alg {
+	case api.AlgHS256, api.AlgRS256, api.AlgES256, api.AlgEdDSA:
+		return true
+	}
+	return false
+}
+
+// Write prints the configuration to `w` as YAML, with secrets redacted.
+func (c *Config) Write(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	for _, s := range c.settings() {
+		section, key, _ := strings.Cut(s.path, ".")
+		mapping, ok := sections[section]
+		if !ok {
+			mapping = &yaml.Node{Kind: yaml.MappingNode}
+			sections[section] = mapping
+			root.Content = append(root.Content, scalarNode(section), mapping)
+		}
+		mapping.Content = append(mapping.Content, scalarNode(key), s.node())
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// setting is a single field of `Config`.
+type setting struct {
+	path   string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists the fields of the sections of `c` in declaration order.
+func (c *Config) settings() []*setting {
+	var settings []*setting
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			settings = append(settings, &setting{
+				path:   sectionName + "." + field.Tag.Get("yaml"),
+				env:    field.Tag.Get("env"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return settings
+}
+
+// flag is the name of the command line flag of the setting.
+func (s *setting) flag() string {
+	return strings.ReplaceAll(s.path, "_", "-")
+}
+
+// set parses `raw` into the setting. Lists are separated by commas or spaces.
+func (s *setting) set(raw string) error {
+	return parseInto(s.value, raw)
+}
+
+func parseInto(value reflect.Value, raw string) error {
+	switch value.Interface().(type) {
+	case string:
+		value.SetString(raw)
+	case int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		value.SetInt(int64(number))
+	case bool:
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		value.SetBool(enabled)
+	case float64:
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		value.SetFloat(number)
+	case time.Duration:
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		value.SetInt(int64(duration))
+	case []string:
+		value.Set(reflect.ValueOf(strings.FieldsFunc(raw, func(r rune) bool {
+			return r == ',' || r == ' '
+		})))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+// node returns the setting for printing.
+func (s *setting) node() *yaml.Node {
+	switch value := s.value.Interface().(type) {
+	case string:
+		if s.secret && value != "" {
+			value = Redacted
+		}
+		return scalarNode(value)
+	case int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(value)}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}
+	case float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(value, 'g', -1, 64)}
+	case time.Duration:
+		return scalarNode(value.String())
+	case []string:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range value {
+			list.Content = append(list.Content, scalarNode(item))
+		}
+		return list
+	}
+	return scalarNode(fmt.Sprint(s.value.Interface()))
+}
+
+// flagValue remembers a flag, so that it is applied after the environment.
+type flagValue struct {
+	setting *setting
+	raw     *string
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.raw == nil {
+		return ""
+	}
+	return *f.raw
+}
+
+// IsBoolFlag allows boolean flags without value, e.g. "-server.validate-requests".
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.setting.value.Interface().(bool)
+	return ok
+}
+
+func (f *flagValue) Set(raw string) error {
+	// Checks the value without changing the setting yet
+	if err := parseInto(reflect.New(f.setting.value.Type()).Elem(), raw); err != nil {
+		return err
+	}
+	f.raw = &raw
+	return nil
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func envOf(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Equal(t, nil, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, envOf(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Default(), cfg)
+	assert.Equal(t, nil, cfg.Validate())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  host: 127.0.0.1
+  port: 9000
+jwt:
+  token_expiration: 30m
+  verification_keys: ["old=RS256:old.pem"]
+oidc:
+  scopes: [groups]
+`)
+	cfg, err := Load(
+		[]string{"-config", path, "-server.port", "9200"},
+		envOf(map[string]string{"PORT": "9100", "TOKEN_EXPIRATION": "15m", "OIDC_SCOPES": "profile email", "TRACING_SAMPLE_RATIO": "0.25"}),
+	)
+	assert.Equal(t, nil, err)
+	// Only in the file
+	assert.Equal(t, "127.0.0.1", cfg.Server.Host)
+	// Environment over file, flags over environment
+	assert.Equal(t, 15*time.Minute, cfg.JWT.TokenExpiration)
+	assert.Equal(t, 9200, cfg.Server.Port)
+	assert.Equal(t, []string{"profile", "email"}, cfg.OIDC.Scopes)
+	assert.Equal(t, []string{"old=RS256:old.pem"}, cfg.JWT.VerificationKeys)
+	assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+	assert.Equal(t, false, cfg.Server.ValidateRequests)
+	// Defaults of settings not set anywhere
+	assert.Equal(t, "gorm.sqlite", cfg.Database.Path)
+
+	// The file can be given in the environment too
+	cfg, err = Load(nil, envOf(map[string]string{FileEnv: path}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 9000, cfg.Server.Port)
+
+	// Boolean flags do not need a value
+	cfg, err = Load([]string{"-server.validate-requests"}, envOf(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, cfg.Server.ValidateRequests)
+	cfg, err = Load(nil, envOf(map[string]string{"VALIDATE_REQUESTS": "true"}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, cfg.Server.ValidateRequests)
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load([]string{"-server.port", "http"}, envOf(nil))
+	assert.NotEqual(t, nil, err)
+	_, err = Load(nil, envOf(map[string]string{"TRASH_RETENTION": "30 days"}))
+	assert.Equal(t, `invalid TRASH_RETENTION: "30 days" is not a duration`, err.Error())
+	_, err = Load(nil, envOf(map[string]string{"VALIDATE_REQUESTS": "sometimes"}))
+	assert.Equal(t, `invalid VALIDATE_REQUESTS: "sometimes" is not a boolean`, err.Error())
+	_, err = Load([]string{"-config", writeFile(t, "typo.yaml", "server:\n  prot: 80\n")}, envOf(nil))
+	assert.NotEqual(t, nil, err)
+	_, err = Load([]string{"-config", writeFile(t, "typo.toml", "[server]\nprot = 80\n")}, envOf(nil))
+	assert.NotEqual(t, nil, err)
+	_, err = Load([]string{"-config", writeFile(t, "config.ini", "")}, envOf(nil))
+	assert.NotEqual(t, nil, err)
+	_, err = Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, envOf(nil))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+[server]
+host = "127.0.0.1"
+port = 9000
+trusted_proxies = ["10.0.0.0/8"]
+
+[jwt]
+token_expiration = "30m"
+
+[tracing]
+sample_ratio = 0.5
+`)
+	cfg, err := Load([]string{"-config", path}, envOf(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "127.0.0.1", cfg.Server.Host)
+	assert.Equal(t, 9000, cfg.Server.Port)
+	assert.Equal(t, []string{"10.0.0.0/8"}, cfg.Server.TrustedProxies)
+	assert.Equal(t, 30*time.Minute, cfg.JWT.TokenExpiration)
+	assert.Equal(t, 0.5, cfg.Tracing.SampleRatio)
+	// Defaults of settings not set in the file
+	assert.Equal(t, "gorm.sqlite", cfg.Database.Path)
+
+	cfg, err = Load([]string{"-config", writeFile(t, "empty.toml", "")}, envOf(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Server.Mode = "production"
+	cfg.JWT.SigningKey = "secret"
+	cfg.JWT.SigningKeyFile = "key.pem"
+	cfg.JWT.VerificationKeys = []string{"old.pem"}
+	cfg.OIDC.Issuer = "https://sso.example.com"
+	cfg.OIDC.StateSecret = "short"
+	cfg.TLS.KeyFile = "key.pem"
+	cfg.TLS.ClientAuth = "require"
+	cfg.TLS.RedirectPort = 8081
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.Tracing.SampleRatio = 2
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"}
+	err := cfg.Validate()
+	assert.NotEqual(t, nil, err)
+	for _, key := range []string{
+		"server.port", "server.mode", "jwt.signing_key_file", "jwt.verification_keys",
+		"oidc.client_id", "oidc.redirect_url", "oidc.state_secret", "tls.key_file", "tls.client_auth", "tls.redirect_port",
+		"tracing.exporter", "tracing.sample_ratio", `server.trusted_proxies entry "proxy.local"`,
+	} {
+		assert.Equal(t, true, strings.Contains(err.Error(), key))
+	}
+}
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.JWT.SigningKey = "supersecretsupersecretsupersecret"
+	cfg.OIDC.ClientID = "client"
+	cfg.Server.ValidateRequests = true
+
+	var buffer bytes.Buffer
+	assert.Equal(t, nil, cfg.Write(&buffer))
+	output := buffer.String()
+	assert.Equal(t, false, strings.Contains(output, "supersecret"))
+	assert.Equal(t, true, strings.Contains(output, "signing_key: "+Redacted))
+	assert.Equal(t, true, strings.Contains(output, "client_id: client"))
+	assert.Equal(t, true, strings.Contains(output, "token_expiration: 1h0m0s"))
+
+	// The printed configuration can be loaded again
+	path := writeFile(t, "printed.yaml", output)
+	loaded, err := Load([]string{"-config", path}, envOf(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "client", loaded.OIDC.ClientID)
+	assert.Equal(t, cfg.JWT.TokenExpiration, loaded.JWT.TokenExpiration)
+	assert.Equal(t, cfg.Tracing.SampleRatio, loaded.Tracing.SampleRatio)
+	assert.Equal(t, true, loaded.Server.ValidateRequests)
+}
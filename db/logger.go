@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Logger passes the logs of gorm to a structured logger. Failed statements
+// are logged as errors, statements slower than `SlowThreshold` as warnings
+// and all other statements only at debug level.
+// Statements are logged with placeholders instead of the bound values, which
+// can be secrets, e.g. password hashes. For that the logger has to be
+// registered as plugin too, with `gorm.DB.Use`, otherwise the SQL is left out.
+type Logger struct {
+	logger        *slog.Logger
+	level         gormlogger.LogLevel
+	SlowThreshold time.Duration
+}
+
+// NewLogger creates a gorm logger writing to `logger`. Set it in `gorm.Config`.
+func NewLogger(logger *slog.Logger, slowThreshold time.Duration) *Logger {
+	return &Logger{logger: logger, level: gormlogger.Info, SlowThreshold: slowThreshold}
+}
+
+// LogMode returns a copy of the logger with `level`, e.g. for `gorm.DB.Debug`.
+func (l *Logger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.logger.InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.logger.WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.logger.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// statementKey is the context key of the statement being executed
+type statementKey struct{}
+
+func (l *Logger) Name() string {
+	return "logger"
+}
+
+// Initialize adds the statement to its context before every operation, so
+// that `Trace` can log its SQL with placeholders.
+func (l *Logger) Initialize(database *gorm.DB) error {
+	callbacks := database.Callback()
+	for _, register := range []func(name string, fn func(*gorm.DB)) error{
+		callbacks.Create().Before("*").Register,
+		callbacks.Query().Before("*").Register,
+		callbacks.Update().Before("*").Register,
+		callbacks.Delete().Before("*").Register,
+		callbacks.Row().Before("*").Register,
+		callbacks.Raw().Before("*").Register,
+	} {
+		if err := register("logger:statement", withStatement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func withStatement(tx *gorm.DB) {
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Statements of a transaction are reused
+	if ctx.Value(statementKey{}) != tx.Statement {
+		tx.Statement.Context = context.WithValue(ctx, statementKey{}, tx.Statement)
+	}
+}
+
+// Trace logs a statement once it finished. The SQL is only rendered if the
+// statement is logged.
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	var level slog.Level
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		level, msg = slog.LevelError, "query failed"
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.level >= gormlogger.Warn:
+		level, msg = slog.LevelWarn, "slow query"
+	case l.level >= gormlogger.Info:
+		level, msg = slog.LevelDebug, "query"
+	default:
+		return
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	// The SQL of `fc` has the bound values filled in
+	_, rows := fc()
+	var attrs []slog.Attr
+	if stmt, ok := ctx.Value(statementKey{}).(*gorm.Statement); ok {
+		attrs = append(attrs, slog.String("sql", stmt.SQL.String()))
+	}
+	attrs = append(attrs,
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
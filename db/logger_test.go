@@ -0,0 +1,75 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewLogger(slog.New(slog.NewJSONHandler(&buffer, nil)), 100*time.Millisecond)
+	query := func() (string, int64) { return "SELECT 1", 1 }
+	ctx := context.Background()
+
+	// Fast statements are only logged at debug level
+	logger.Trace(ctx, time.Now(), query, nil)
+	logger.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	if buffer.Len() != 0 {
+		t.Errorf("logged %q, want nothing", buffer.String())
+	}
+
+	logger.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	if !strings.Contains(buffer.String(), `"level":"WARN","msg":"slow query","rows":1`) {
+		t.Errorf("logged %q, want slow query", buffer.String())
+	}
+	buffer.Reset()
+	logger.Trace(ctx, time.Now(), query, errors.New("no such table"))
+	if !strings.Contains(buffer.String(), `"level":"ERROR","msg":"query failed"`) ||
+		!strings.Contains(buffer.String(), `"error":"no such table"`) {
+		t.Errorf("logged %q, want failed query", buffer.String())
+	}
+
+	buffer.Reset()
+	logger.LogMode(gormlogger.Silent).Trace(ctx, time.Now(), query, errors.New("no such table"))
+	if buffer.Len() != 0 {
+		t.Errorf("logged %q in silent mode", buffer.String())
+	}
+}
+
+func TestLoggerOmitsBoundValues(t *testing.T) {
+	var buffer bytes.Buffer
+	handler := slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := NewLogger(slog.New(handler), time.Second)
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Use(logger); err != nil {
+		t.Fatal(err)
+	}
+	Migrate(database)
+
+	buffer.Reset()
+	user := User{Username: "logged"}
+	if err := user.SetPassword("secret-password1"); err != nil {
+		t.Fatal(err)
+	}
+	database.Create(&user)
+	database.Where("username = ?", "logged").First(&User{})
+	logged := buffer.String()
+	if !strings.Contains(logged, `"sql":"INSERT INTO`) || !strings.Contains(logged, "WHERE username = ?") {
+		t.Errorf("logged %q, want statements with placeholders", logged)
+	}
+	if strings.Contains(logged, user.PasswordHash) || strings.Contains(logged, `"logged"`) {
+		t.Errorf("logged %q, want no bound values", logged)
+	}
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy defines which passwords `User.SetPassword` accepts.
+type PasswordPolicy struct {
+	MinLength int
+	// Maximum length in bytes, bcrypt refuses longer passwords
+	MaxLength int
+	// Require at least one letter
+	RequireLetter bool
+	// Require at least one digit or symbol
+	RequireNonLetter bool
+	// Uppercase hex SHA-1 hashes of passwords known from data breaches
+	Breached map[string]struct{}
+}
+
+// Policy is the password policy enforced by `User.SetPassword`.
+var Policy = PasswordPolicy{
+	MinLength:        8,
+	MaxLength:        72,
+	RequireLetter:    true,
+	RequireNonLetter: true,
+}
+
+var (
+	ErrPasswordEmpty    = errors.New("password should not be empty")
+	ErrPasswordWeak     = errors.New("password does not meet the password policy")
+	ErrPasswordLong     = errors.New("password is too long")
+	ErrPasswordBreached = errors.New("password has appeared in a data breach")
+)
+
+var sha1Line = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// CheckStrength checks length and composition of `password`.
+func (p PasswordPolicy) CheckStrength(password string) error {
+	if len(password) == 0 {
+		return ErrPasswordEmpty
+	}
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", ErrPasswordWeak, p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("%w: at most %d bytes allowed", ErrPasswordLong, p.MaxLength)
+	}
+	var hasLetter, hasNonLetter bool
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		} else {
+			hasNonLetter = true
+		}
+	}
+	if p.RequireLetter && !hasLetter {
+		return fmt.Errorf("%w: a letter is required", ErrPasswordWeak)
+	}
+	if p.RequireNonLetter && !hasNonLetter {
+		return fmt.Errorf("%w: a digit or symbol is required", ErrPasswordWeak)
+	}
+	return nil
+}
+
+// IsBreached checks whether `password` is in the breached password list.
+func (p PasswordPolicy) IsBreached(password string) bool {
+	if len(p.Breached) == 0 {
+		return false
+	}
+	_, found := p.Breached[sha1Hex(password)]
+	return found
+}
+
+// Check returns error if `password` violates any rule of the policy.
+func (p PasswordPolicy) Check(password string) error {
+	if err := p.CheckStrength(password); err != nil {
+		return err
+	}
+	if p.IsBreached(password) {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// LoadBreachedPasswords reads a breached password list from `path`.
+// Each line is either a plain text password or a SHA-1 hash in the
+// "Have I Been Pwned" format, optionally followed by ":<count>".
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if sha1Line.MatchString(line) {
+			breached[strings.ToUpper(line[:40])] = struct{}{}
+		} else {
+			breached[sha1Hex(line)] = struct{}{}
+		}
+	}
+	return breached, scanner.Err()
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 72, RequireLetter: true, RequireNonLetter: true}
+	cases := map[string]error{
+		"":                             ErrPasswordEmpty,
+		strings.Repeat("password1", 9): ErrPasswordLong,
+		"short1":                       ErrPasswordWeak,
+		"12345678":                     ErrPasswordWeak,
+		"password":                     ErrPasswordWeak,
+		"password1!":                   nil,
+	}
+	for password, want := range cases {
+		if err := policy.Check(password); !errors.Is(err, want) {
+			t.Errorf("Check(%q) = %v, want %v", password, err, want)
+		}
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// SHA-1 of "password1" in the "Have I Been Pwned" format and a plain text password
+	content := "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D:2413945\nletmein123\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := PasswordPolicy{MinLength: 8, Breached: breached}
+	for _, password := range []string{"password1", "letmein123"} {
+		if err := policy.Check(password); !errors.Is(err, ErrPasswordBreached) {
+			t.Errorf("Check(%q) = %v, want %v", password, err, ErrPasswordBreached)
+		}
+	}
+	if err := policy.Check("correct horse battery"); err != nil {
+		t.Errorf("Check(%q) = %v, want nil", "correct horse battery", err)
+	}
+}
@@ -2,7 +2,8 @@
 package db
 
 import (
-	"errors"
+	"fmt"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -12,7 +13,7 @@ import (
 func FillDB(database *gorm.DB) {
 	// TODO: try this in one go
 	user := User{Username: "test"}
-	user.SetPassword("testpass")
+	user.SetPassword("testpass1")
 	database.Create(&user)
 
 	// Create the assets
@@ -32,30 +33,105 @@ func FillDB(database *gorm.DB) {
 	database.Create(&audience)
 }
 
+// models are the tables managed by `Migrate`
+var models = []interface{}{
+	&User{},
+	&Asset{},
+	&Chart{},
+	&Insight{},
+	&Characteristic{},
+	&Audience{},
+	&RevokedToken{},
+	&TokenRevocation{},
+	&PasswordReset{},
+	&RecoveryCode{},
+	&ExternalIdentity{},
+	&APIKey{},
+	&EmailVerification{},
+}
+
 // Migrate migrates changes in the models into databse `db`
 func Migrate(db *gorm.DB) {
-	db.AutoMigrate(&User{})
-	db.AutoMigrate(&Asset{})
-	db.AutoMigrate(&Chart{})
-	db.AutoMigrate(&Insight{})
-	db.AutoMigrate(&Characteristic{})
-	db.AutoMigrate(&Audience{})
+	for _, model := range models {
+		db.AutoMigrate(model)
+	}
+}
+
+// CheckMigrated returns an error naming a table or column of the models that
+// is missing in `db`, e.g. if `Migrate` has not been run with this version.
+func CheckMigrated(db *gorm.DB) error {
+	migrator := db.Migrator()
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("table %s is missing", stmt.Schema.Table)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				return fmt.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+	return nil
 }
 
 type User struct {
-	ID           uint     `gorm:"primarykey;not null;autoIncrement:true" json:"id"`
-	Username     string   `gorm:"unique;not null" json:"username"`
-	PasswordHash string   `gorm:"column:password;not null" json:"-"`
-	Favourites   []*Asset `gorm:"many2many:user_assets;" json:"-"`
+	ID       uint   `gorm:"primarykey;not null;autoIncrement:true" json:"id"`
+	Username string `gorm:"unique;not null" json:"username"`
+	// Empty for users signing in only through an external identity provider
+	PasswordHash string         `gorm:"column:password;not null" json:"-"`
+	Favourites   []*Asset       `gorm:"many2many:user_assets;" json:"-"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	// Two-factor authentication, the secret is set on enrollment but only
+	// required for login once enabled by verifying the first code
+	TOTPSecret   string `gorm:"column:totp_secret;size:64" json:"-"`
+	TOTPEnabled  bool   `gorm:"column:totp_enabled;not null;default:false" json:"-"`
+	TOTPLastStep int64  `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	Role         string `gorm:"size:16;not null;default:user" json:"-"`
+	// Disabled users cannot log in and their API keys stop working
+	Disabled bool `gorm:"not null;default:false" json:"-"`
+	// Set by administrators, login with password fails until it is reset
+	MustResetPassword bool `gorm:"not null;default:false" json:"-"`
+	// Profile, `Email` is only set once verified, see `EmailVerification`
+	DisplayName  string  `gorm:"size:64;not null;default:''" json:"-"`
+	Email        *string `gorm:"uniqueIndex;size:254" json:"-"`
+	PendingEmail string  `gorm:"size:254;not null;default:''" json:"-"`
+	Locale       string  `gorm:"size:35;not null;default:''" json:"-"`
+	Timezone     string  `gorm:"size:64;not null;default:''" json:"-"`
+	AvatarURL    string  `gorm:"size:2048;not null;default:''" json:"-"`
 }
 
-// Note: When Asset gets deleted, all of the linked types get deleted
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// PromoteAdmin gives the admin role to the user `username`.
+// Returns `gorm.ErrRecordNotFound` if there is no such user.
+func PromoteAdmin(db *gorm.DB, username string) error {
+	result := db.Model(&User{}).Where("username = ?", username).Update("role", RoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Note: Deleting an Asset only moves it to the trash, see `PurgeDeleted`.
+// When Asset gets purged, all of the linked types get deleted
 type Asset struct {
-	ID       uint      `gorm:"primarykey;not null;autoIncrement:true" json:"id"`
-	Users    []*User   `gorm:"many2many:user_assets;" json:"-"`
-	Chart    *Chart    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"chart,omitempty"`
-	Insight  *Insight  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"insight,omitempty"`
-	Audience *Audience `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"audience,omitempty"`
+	ID        uint           `gorm:"primarykey;not null;autoIncrement:true" json:"id"`
+	Users     []*User        `gorm:"many2many:user_assets;" json:"-"`
+	Chart     *Chart         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"chart,omitempty"`
+	Insight   *Insight       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"insight,omitempty"`
+	Audience  *Audience      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"audience,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type Chart struct {
@@ -91,17 +167,96 @@ type Audience struct {
 	Characteristics []*Characteristic `gorm:"many2many:audience_characteristics;" json:"characteristics,omitempty"`
 }
 
+// RevokedToken is a single token revoked before its expiration, e.g. on logout.
+// It can be removed once `ExpiresAt` passes.
+type RevokedToken struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// TokenRevocation revokes all tokens of a user issued before `RevokedAt`,
+// e.g. on password change or account deletion.
+type TokenRevocation struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	RevokedAt time.Time `gorm:"not null"`
+}
+
+// PasswordReset is a single-use token for resetting a forgotten password.
+// Only SHA-256 hash of the token is stored.
+type PasswordReset struct {
+	ID        uint      `gorm:"primaryKey;not null;autoIncrement:true"`
+	UserID    uint      `gorm:"index;not null"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	TokenHash string    `gorm:"size:64;unique;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+// EmailVerification is a single-use token sent to `Email`, which becomes the
+// email of the user once confirmed. Only SHA-256 hash of the token is stored.
+type EmailVerification struct {
+	ID        uint      `gorm:"primaryKey;not null;autoIncrement:true"`
+	UserID    uint      `gorm:"index;not null"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	Email     string    `gorm:"size:254;not null"`
+	TokenHash string    `gorm:"size:64;unique;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+// RecoveryCode is a single-use replacement of a TOTP code.
+// Only SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID       uint   `gorm:"primaryKey;not null;autoIncrement:true"`
+	UserID   uint   `gorm:"index;not null"`
+	CodeHash string `gorm:"size:64;not null"`
+	UsedAt   *time.Time
+}
+
+// ExternalIdentity links a user of an OpenID Connect provider, identified by
+// the "iss" and "sub" claims of its ID tokens, to a `User`.
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primaryKey;not null;autoIncrement:true" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	Issuer    string    `gorm:"uniqueIndex:idx_external_identity;not null" json:"issuer"`
+	Subject   string    `gorm:"uniqueIndex:idx_external_identity;not null" json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey is a long-lived credential of a user for non-interactive access.
+// Only SHA-256 hash of the key is stored, `Prefix` identifies it for humans.
+type APIKey struct {
+	ID      uint   `gorm:"primaryKey;not null;autoIncrement:true"`
+	UserID  uint   `gorm:"index;not null"`
+	Name    string `gorm:"size:64;not null"`
+	Prefix  string `gorm:"size:16;not null"`
+	KeyHash string `gorm:"size:64;uniqueIndex;not null"`
+	// Space separated scopes granted to the key
+	Scopes     string `gorm:"not null"`
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// SetPassword hashes `password` into `PasswordHash`.
+// Returns error if the password violates `Policy`.
 func (u *User) SetPassword(password string) error {
-	if len(password) == 0 {
-		return errors.New("password should not be empty")
+	if err := Policy.Check(password); err != nil {
+		return err
 	}
 	bytePassword := []byte(password)
 	// Make sure the second param `bcrypt generator cost` between [4, 32)
-	passwordHash, _ := bcrypt.GenerateFromPassword(bytePassword, bcrypt.DefaultCost)
+	passwordHash, err := bcrypt.GenerateFromPassword(bytePassword, bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
 	u.PasswordHash = string(passwordHash)
 	return nil
 }
 
+// CheckPassword compares `password` with `PasswordHash`.
+// Always fails for users without a password.
 func (u *User) CheckPassword(password string) error {
 	bytePassword := []byte(password)
 	byteHashedPassword := []byte(u.PasswordHash)
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TrashRetention is how long soft-deleted users and assets are kept in the
+// trash before `PurgeDeleted` removes them for good.
+var TrashRetention = 30 * 24 * time.Hour
+
+// PurgeAt returns the time at which a record deleted at `deletedAt` gets purged.
+func PurgeAt(deletedAt gorm.DeletedAt) time.Time {
+	return deletedAt.Time.Add(TrashRetention)
+}
+
+// PurgeDeleted permanently removes users and assets that have been in the
+// trash for longer than `TrashRetention`, together with their favourites
+// and linked charts, insights and audiences.
+// Returns the number of purged users and assets.
+func PurgeDeleted(database *gorm.DB) (users int64, assets int64, err error) {
+	cutoff := time.Now().Add(-TrashRetention)
+	err = database.Transaction(func(tx *gorm.DB) error {
+		var dbAssets []Asset
+		result := tx.Unscoped().Where("deleted_at < ?", cutoff).Find(&dbAssets)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(dbAssets) > 0 {
+			// Characteristics are linked to the audience, not the asset itself
+			audiences := tx.Model(&Audience{}).Select("id").Where("asset_id IN ?", assetIDs(dbAssets))
+			result = tx.Exec("DELETE FROM audience_characteristics WHERE audience_id IN (?)", audiences)
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Unscoped().Select(clause.Associations).Delete(&dbAssets)
+			if result.Error != nil {
+				return result.Error
+			}
+			assets = result.RowsAffected
+		}
+
+		var dbUsers []User
+		result = tx.Unscoped().Where("deleted_at < ?", cutoff).Find(&dbUsers)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(dbUsers) > 0 {
+			result = tx.Where("user_id IN ?", userIDs(dbUsers)).Delete(&PasswordReset{})
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Where("user_id IN ?", userIDs(dbUsers)).Delete(&RecoveryCode{})
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Where("user_id IN ?", userIDs(dbUsers)).Delete(&ExternalIdentity{})
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Where("user_id IN ?", userIDs(dbUsers)).Delete(&APIKey{})
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Where("user_id IN ?", userIDs(dbUsers)).Delete(&EmailVerification{})
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Unscoped().Select("Favourites").Delete(&dbUsers)
+			if result.Error != nil {
+				return result.Error
+			}
+			users = result.RowsAffected
+		}
+		return nil
+	})
+	return
+}
+
+// SchedulePurge runs `PurgeDeleted` every `interval` until `ctx` is done.
+// Errors are passed to `onError`, which may be nil.
+func SchedulePurge(ctx context.Context, database *gorm.DB, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, _, err := PurgeDeleted(database); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func assetIDs(assets []Asset) []uint {
+	ids := make([]uint, len(assets))
+	for i, asset := range assets {
+		ids[i] = asset.ID
+	}
+	return ids
+}
+
+func userIDs(users []User) []uint {
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids
+}